@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"proxyMan/server/common"
+	"proxyMan/server/session"
+	"strings"
+)
+
+// runCommand 执行子命令（例如 proxyman export），不是子命令时返回 false
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = runExport(args[1:])
+	case "import":
+		err = runImport(args[1:])
+	case "session":
+		err = runSession(args[1:])
+	default:
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// apiClient 访问正在运行的 proxyMan 的管理接口
+type apiClient struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+// addAPIFlags 添加连接管理接口的参数
+func addAPIFlags(fs *flag.FlagSet) func() *apiClient {
+	server := fs.String("server", "http://127.0.0.1:8080", "proxyMan 管理界面地址")
+	token := fs.String("token", "", "API 令牌，默认读取 ~/.proxyMan/config.json")
+	insecure := fs.Bool("insecure", false, "不校验管理界面的 HTTPS 证书")
+	return func() *apiClient {
+		c := &apiClient{server: strings.TrimRight(*server, "/"), token: *token, client: &http.Client{}}
+		if c.token == "" {
+			c.token = common.GetConfig().APIToken
+		}
+		if *insecure {
+			c.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		}
+		return c
+	}
+}
+
+// do 发送请求，非 2xx 响应返回错误
+func (c *apiClient) do(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// addFilterFlags 添加选择请求的参数（与 /api/requests 的过滤参数相同），action 用于说明
+func addFilterFlags(fs *flag.FlagSet, action string) func() url.Values {
+	params := map[string]*string{
+		"ids":         fs.String("ids", "", "只"+action+"指定 ID 的请求，多个用逗号分隔"),
+		"host":        fs.String("host", "", "host 包含该字符串或匹配通配符（例如 *.example.com）"),
+		"method":      fs.String("method", "", "请求方法"),
+		"statusMin":   fs.String("status-min", "", "最小状态码"),
+		"statusMax":   fs.String("status-max", "", "最大状态码"),
+		"contentType": fs.String("content-type", "", "响应 Content-Type 包含该字符串"),
+		"q":           fs.String("q", "", "URL 包含该字符串"),
+		"tag":         fs.String("tag", "", "标签"),
+		"session":     fs.String("session", "", "会话名称"),
+		"from":        fs.String("from", "", "开始时间（RFC3339 或毫秒时间戳）"),
+		"to":          fs.String("to", "", "结束时间（RFC3339 或毫秒时间戳）"),
+	}
+	return func() url.Values {
+		query := url.Values{}
+		for name, value := range params {
+			if *value != "" {
+				query.Set(name, *value)
+			}
+		}
+		return query
+	}
+}
+
+// runExport 将抓包记录导出为 HAR：proxyman export [-o file] [-ids 1,2] [-host *.example.com] ...
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	newClient := addAPIFlags(fs)
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	query := addFilterFlags(fs, "导出")
+	_ = fs.Parse(args)
+
+	resp, err := newClient().do("GET", "/api/export/har?"+query().Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// runImport 导入 HAR 文件：proxyman import session.har，文件为 - 时从标准输入读取
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	newClient := addAPIFlags(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: proxyman import [flags] <file.har>")
+	}
+
+	var in io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	resp, err := newClient().do("POST", "/api/import/har", in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status  bool    `json:"status"`
+		Msg     string  `json:"msg"`
+		IDs     []int64 `json:"ids"`
+		Skipped int     `json:"skipped"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Status {
+		return errors.New(result.Msg)
+	}
+	fmt.Printf("Imported %d requests", len(result.IDs))
+	if len(result.IDs) > 0 {
+		fmt.Printf(" (ID %d-%d)", result.IDs[0], result.IDs[len(result.IDs)-1])
+	}
+	if result.Skipped > 0 {
+		fmt.Printf(", skipped %d invalid entries", result.Skipped)
+	}
+	fmt.Println()
+	return nil
+}
+
+// runSession 保存或打开会话文件：proxyman session save|load ...
+func runSession(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "save":
+			return runSessionSave(args[1:])
+		case "load":
+			return runSessionLoad(args[1:])
+		}
+	}
+	return fmt.Errorf("usage: proxyman session save|load [flags]")
+}
+
+// runSessionSave 保存会话：proxyman session save [-name name] [-o file] [-ids 1,2] [-host *.example.com] ...
+func runSessionSave(args []string) error {
+	fs := flag.NewFlagSet("session save", flag.ExitOnError)
+	newClient := addAPIFlags(fs)
+	name := fs.String("name", "", "会话名称，默认使用当前时间")
+	output := fs.String("o", "", "输出文件，默认使用服务端给出的文件名")
+	query := addFilterFlags(fs, "保存")
+	_ = fs.Parse(args)
+
+	params := query()
+	if *name != "" {
+		params.Set("name", *name)
+	}
+	resp, err := newClient().do("GET", "/api/session/save?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	file := *output
+	if file == "" {
+		_, disposition, _ := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		file = filepath.Base(disposition["filename"])
+		if file == "." || file == "/" {
+			return fmt.Errorf("missing file name, use -o")
+		}
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return err
+	}
+	fmt.Println("Saved session to", file)
+	return nil
+}
+
+// runSessionLoad 打开会话文件：proxyman session load [-name name] <file.proxyman>
+func runSessionLoad(args []string) error {
+	fs := flag.NewFlagSet("session load", flag.ExitOnError)
+	newClient := addAPIFlags(fs)
+	name := fs.String("name", "", "会话名称，默认使用文件中保存的名称")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: proxyman session load [flags] <file%s>", session.Extension)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	path := "/api/session/load"
+	if *name != "" {
+		path += "?" + url.Values{"name": {*name}}.Encode()
+	}
+	resp, err := newClient().do("POST", path, f)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status bool    `json:"status"`
+		Msg    string  `json:"msg"`
+		Name   string  `json:"name"`
+		IDs    []int64 `json:"ids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Status {
+		return errors.New(result.Msg)
+	}
+	fmt.Printf("Loaded session %q with %d requests", result.Name, len(result.IDs))
+	if len(result.IDs) > 0 {
+		fmt.Printf(" (ID %d-%d)", result.IDs[0], result.IDs[len(result.IDs)-1])
+	}
+	fmt.Println()
+	return nil
+}
@@ -9,6 +9,21 @@ export interface DataChunk {
   dataType: number
   data?: string
   finished?: boolean
+  offset?: number
+}
+
+// 二进制帧：4 字节大端序的头部长度、JSON 头部、原始数据
+export interface BinaryDataChunk {
+  dataType: number
+  finished?: boolean
+  offset?: number
+  bytes: Uint8Array
+}
+
+export function parseBinaryChunk(frame: ArrayBuffer): BinaryDataChunk {
+  const headerLength = new DataView(frame).getUint32(0)
+  const header = JSON.parse(new TextDecoder().decode(new Uint8Array(frame, 4, headerLength)))
+  return {...header, bytes: new Uint8Array(frame, 4 + headerLength)}
 }
 
 export class RequestDetailsManager {
@@ -23,6 +38,8 @@ export class RequestDetailsManager {
   private readonly requestState: Ref<number>
   private readonly isLoading: Ref<boolean>
   private readonly error: Ref<string | null>
+  // body 分块到达，多字节字符可能跨块，按 body 分别流式解码
+  private decoders: Record<number, TextDecoder> = {}
 
   constructor() {
     this.wsManager = new WebSocketManager()
@@ -50,9 +67,9 @@ export class RequestDetailsManager {
     this.currentRequestId = requestId
     this.isLoading.value = true
 
-    // Connect to WebSocket for request details
+    // Connect to WebSocket for request details, body 使用二进制帧传输
     this.wsManager.connect(
-      `/requests/details/${requestId}`,
+      `/requests/details/${requestId}?format=binary`,
       this.handleDataChunk.bind(this),
       this.handleError.bind(this)
     )
@@ -66,17 +83,24 @@ export class RequestDetailsManager {
     this.error.value = null
     this.requestState.value = -1
     this.isLoading.value = false
+    this.decoders = {}
   }
 
-  private handleDataChunk(chunk: DataChunk): void {
+  private handleDataChunk(chunk: DataChunk | ArrayBuffer): void {
     try {
-      const {dataType, data, finished} = chunk
-
       // Set loading to false once we receive the first chunk
       if (this.isLoading.value) {
         this.isLoading.value = false
       }
 
+      if (chunk instanceof ArrayBuffer) {
+        const {dataType, finished, bytes} = parseBinaryChunk(chunk)
+        this.processDataType(dataType, this.decodeBytes(dataType, bytes, finished), finished)
+        return
+      }
+
+      const {dataType, data, finished} = chunk
+
       // Decode base64 data intelligently with UTF-8 support
       const decodedData = data ? this.decodeBase64Data(data) : ''
 
@@ -88,6 +112,13 @@ export class RequestDetailsManager {
     }
   }
 
+  private decodeBytes(dataType: number, bytes: Uint8Array, finished?: boolean): string {
+    if (!this.decoders[dataType]) {
+      this.decoders[dataType] = new TextDecoder('utf-8')
+    }
+    return this.decoders[dataType].decode(bytes, {stream: !finished})
+  }
+
   private decodeBase64Data(data: string): string {
     try {
       // Always decode from base64 first (server sends all data as base64)
@@ -1,5 +1,5 @@
 import {ref, type Ref} from 'vue'
-import {getWebSocketUrl} from '@/utils/Environment'
+import {getWebSocketUrl, withApiToken} from '@/utils/Environment'
 
 export class WebSocketManager {
   private ws: WebSocket | null = null
@@ -12,7 +12,10 @@ export class WebSocketManager {
   public isConnecting: Ref<boolean> = ref(false)
   public error: Ref<string | null> = ref(null)
 
-  async connect(path: string, onMessage: (data: any) => void, onError?: (error: Error) => void, needReconnect: boolean = false): Promise<void> {
+  /**
+   * path 可以是函数，每次（重新）连接时计算，用于携带断线续传参数
+   */
+  async connect(path: string | (() => string), onMessage: (data: any) => void, onError?: (error: Error) => void, needReconnect: boolean = false): Promise<void> {
     if (this.ws && this.ws.readyState === WebSocket.OPEN) {
       return
     }
@@ -21,10 +24,11 @@ export class WebSocketManager {
     this.error.value = null
 
     // 使用新的 URL 构造方法
-    const url = await getWebSocketUrl(path)
+    const url = await withApiToken(await getWebSocketUrl(typeof path === 'function' ? path() : path))
 
     try {
       this.ws = new WebSocket(url)
+      this.ws.binaryType = 'arraybuffer'
 
       this.ws.onopen = () => {
         this.isConnected.value = true
@@ -35,7 +39,8 @@ export class WebSocketManager {
 
       this.ws.onmessage = (event: MessageEvent) => {
         try {
-          const data = JSON.parse(event.data)
+          // 二进制消息原样交给调用方解析
+          const data = event.data instanceof ArrayBuffer ? event.data : JSON.parse(event.data)
           onMessage(data)
         } catch (err) {
           console.error('Failed to parse WebSocket message:', err)
@@ -80,6 +85,17 @@ export class WebSocketManager {
     }
   }
 
+  /**
+   * 发送 JSON 消息，未连接时返回 false
+   */
+  send(data: any): boolean {
+    if (!this.ws || this.ws.readyState !== WebSocket.OPEN) {
+      return false
+    }
+    this.ws.send(JSON.stringify(data))
+    return true
+  }
+
   disconnect(): void {
     if (this.reconnectTimeout) {
       clearTimeout(this.reconnectTimeout)
@@ -9,6 +9,11 @@ export const useRequestsStore = defineStore('requests', () => {
   const selectedRequestId = ref(null)
   const sortColumn = ref('id')
   const sortOrder = ref('desc')
+  // 最后收到的事件序号和请求 ID，重新连接时用于补发
+  let lastSeq = 0
+  let lastId = 0
+  // 服务端订阅条件，只接收匹配的请求
+  const serverFilter = ref(null)
   
   // Managers
   const wsManager = new WebSocketManager()
@@ -48,7 +53,43 @@ export const useRequestsStore = defineStore('requests', () => {
 
   // WebSocket connection handlers
   const connect = () => {
-    wsManager.connect('/requests', handleRequestSummary, handleConnectionError, true)
+    wsManager.connect(requestsPath, handleMessage, handleConnectionError, true)
+  }
+
+  const requestsPath = () => {
+    const params = new URLSearchParams()
+    if (lastSeq > 0) params.set('seq', String(lastSeq))
+    if (lastId > 0) params.set('since', String(lastId))
+    if (serverFilter.value) params.set('filter', JSON.stringify(serverFilter.value))
+    const query = params.toString()
+    return query ? `/requests?${query}` : '/requests'
+  }
+
+  // 处理 /requests 消息：连接时的快照或带序号的实时事件
+  const handleMessage = (message) => {
+    if (message?.type === 'snapshot') {
+      lastSeq = message.seq
+      ;(message.data || []).forEach(summary => handleRequestSummary(summary, false))
+      return
+    }
+    if (message?.type === 'error') {
+      console.warn('Request stream error:', message.data)
+      return
+    }
+    if (message?.type !== 'event') {
+      console.warn('Unknown message received:', message)
+      return
+    }
+
+    if (lastSeq > 0 && message.prev !== lastSeq) {
+      // 与上一条消息不连续，重新连接以补发缺失的事件（同一请求的合并更新只会让 seq 跳跃，prev 仍然连续）
+      console.warn(`Missed request events after ${lastSeq}, resyncing`)
+      wsManager.disconnect()
+      connect()
+      return
+    }
+    lastSeq = message.seq
+    handleRequestSummary(message.data)
   }
 
   const disconnect = () => {
@@ -56,12 +97,13 @@ export const useRequestsStore = defineStore('requests', () => {
   }
 
   // Handle incoming request summaries from WebSocket
-  const handleRequestSummary = (summary) => {
+  const handleRequestSummary = (summary, animate = true) => {
     // Validate incoming data
     if (!summary || !summary.id) {
       console.warn('Invalid request summary received:', summary)
       return
     }
+    lastId = Math.max(lastId, summary.id)
 
     const existingIndex = requests.value.findIndex(req => req.id === summary.id)
 
@@ -78,7 +120,7 @@ export const useRequestsStore = defineStore('requests', () => {
       const newRequest = {
         ...summary,
         duration: calculateDuration(summary.startTime, summary.endTime),
-        isNew: true
+        isNew: animate
       }
       
       requests.value.unshift(newRequest)
@@ -134,8 +176,18 @@ export const useRequestsStore = defineStore('requests', () => {
   }
 
   const clearRequests = () => {
+    // 清空后不再重新加载之前的请求
+    requests.value = []
+    selectedRequestId.value = null
+  }
+
+  // 修改服务端订阅条件，服务端随后发送符合新条件的快照
+  const setServerFilter = (filter) => {
+    serverFilter.value = filter && Object.keys(filter).length > 0 ? filter : null
     requests.value = []
     selectedRequestId.value = null
+    lastId = 0
+    wsManager.send({ type: 'filter', filter: serverFilter.value })
   }
 
   const setSorting = (column) => {
@@ -215,6 +267,7 @@ export const useRequestsStore = defineStore('requests', () => {
     selectedRequestId,
     sortColumn,
     sortOrder,
+    serverFilter,
 
     // Computed properties
     selectedRequest,
@@ -238,6 +291,7 @@ export const useRequestsStore = defineStore('requests', () => {
     disconnect,
     selectRequest,
     clearRequests,
+    setServerFilter,
     setSorting,
 
     // Utilities
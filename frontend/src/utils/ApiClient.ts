@@ -3,7 +3,7 @@
  * 自动处理 Wails 和 Web 两种环境的请求
  */
 
-import {getHttpBaseUrl} from './Environment'
+import {getApiToken, getHttpBaseUrl, withApiToken} from './Environment'
 
 // API 数据类型定义
 export interface ProxyConfig {
@@ -11,6 +11,9 @@ export interface ProxyConfig {
   msg: string
   host: string
   port: number
+  draining?: boolean    // 是否正在等待旧连接结束
+  activeConns?: number  // 活动连接数
+  tunnels?: number      // 其中 CONNECT 隧道数
 }
 
 export interface CertStatus {
@@ -39,13 +42,180 @@ export interface UninstallResult {
 }
 
 export interface UpstreamProxyConfig {
-  mode: string      // "none", "env", "custom"
+  mode: string      // "none", "env", "custom", "pac"
   protocol: string  // http, socket5
   host: string
   port: number
+  pacUrl?: string   // PAC 文件路径或 URL
+  pacError?: string // PAC 脚本加载失败的原因，后台持续重试
   envProxy?: string // 环境变量中的代理地址
 }
 
+export interface Listener {
+  name: string
+  label?: string
+  mode: string      // http, socks, transparent, reverse
+  host: string
+  port: number
+  enabled: boolean
+  tproxy?: boolean  // 透明代理：使用 TPROXY
+  target?: string   // 反向代理：后端地址，例如 http://localhost:3000
+  tls?: boolean     // 反向代理：是否终止 TLS
+  running?: boolean
+  draining?: boolean
+  active_conns?: number
+  tunnels?: number
+  error?: string
+}
+
+export interface CaptureConfig {
+  includeHosts: string[] // 需要经过代理的域名，为空表示全部
+  excludeHosts: string[] // 直连的域名
+  pacPath?: string       // PAC 文件路径
+}
+
+export interface AccessConfig {
+  authEnabled: boolean    // 是否开启代理认证
+  username: string
+  password?: string       // 修改时为空表示保留原密码
+  hasPassword?: boolean
+  allowedCidrs: string[]  // 允许连接的客户端网段，为空表示不限制
+}
+
+export interface RejectedAttempt {
+  time: string
+  client: string
+  listener: string
+  reason: string
+  target?: string
+}
+
+export interface StorageConfig {
+  enabled: boolean
+  dir: string          // 为空时使用默认目录
+  maxCount: number     // 保留限制，0 表示不限制
+  maxAgeHours: number
+  maxSizeMB: number
+  stats?: StorageStats | null
+}
+
+export interface StorageStats {
+  count: number
+  bytes: number
+  segments: number
+  oldest?: string
+}
+
+export interface RequestQuery {
+  host?: string         // 域名及其子域名，或通配符，例如 *.example.com
+  method?: string
+  statusMin?: number
+  statusMax?: number
+  contentType?: string
+  from?: string | number  // RFC3339 或毫秒时间戳
+  to?: string | number
+  q?: string            // URL 包含
+  tag?: string
+  session?: string      // 会话名称
+  replayOf?: number     // 重放的原请求 ID
+  sort?: 'id' | 'time' | 'duration' | 'status' | 'method' | 'host' | 'url'
+  order?: 'asc' | 'desc'
+  offset?: number
+  limit?: number
+}
+
+export interface ReplayOptions {
+  headers?: Record<string, string>                       // 覆盖的 header，值为空时删除
+  body?: { encoding: 'utf8' | 'base64'; data: string }   // 覆盖的请求 body
+  repeat?: number                                        // 重放次数，默认 1，最多 100
+  concurrency?: number                                   // 同时发送的请求数，默认 1，最多 10
+}
+
+// 重放或构造请求的结果，id 为记录的新请求
+export interface SendResult {
+  id: number
+  statusCode: number
+  proto?: string     // 响应的协议版本，例如 HTTP/2.0
+  finalUrl?: string  // 跟随重定向后的地址
+  duration: number   // 毫秒
+  error?: string
+}
+
+export interface ComposeRequest {
+  method?: string                                        // 默认 GET
+  url: string
+  headers?: Record<string, string>                       // Host 用于覆盖请求的 Host
+  body?: { encoding: 'utf8' | 'base64'; data: string }
+  httpVersion?: '' | '1.1' | '2'                         // 为空时自动协商
+  timeout?: number                                       // 秒，默认 30
+  followRedirects?: boolean
+}
+
+// 实时请求推送的订阅条件，同一字段的多个值满足任意一个即可
+export interface SummaryFilter {
+  hosts?: string[]        // 域名及其子域名，或通配符，例如 *.example.com
+  methods?: string[]
+  statusMin?: number
+  statusMax?: number
+  contentTypes?: string[]
+  listeners?: string[]
+  tags?: string[]
+}
+
+export interface RequestPage<T = Record<string, any>> {
+  total: number   // 按 ID 排序且之后还有匹配的请求时为 -1
+  more: boolean   // 之后还有匹配的请求
+  offset: number
+  limit: number
+  items: T[]
+}
+
+export interface EncodedBody {
+  encoding: 'utf8' | 'base64'
+  data: string
+  size: number
+}
+
+export interface RequestDetail extends Record<string, any> {
+  id: number
+  requestHeaders: Record<string, string[]> | null
+  requestBody: EncodedBody
+  responseHeaders: Record<string, string[]> | null
+  responseBody: EncodedBody
+  error?: string
+}
+
+export interface CacheConfig {
+  maxCount: number        // 内存中保留的请求数量，0 表示不限制
+  maxSizeMB: number       // body 总大小上限，0 表示不限制
+  eviction: 'lru' | 'age' // 淘汰顺序
+  stats?: CacheStats
+  body?: BodyStats
+}
+
+export interface CacheStats {
+  count: number
+  bytes: number
+  pinned: number
+  inflight: number
+}
+
+export interface BodyConfig {
+  spillThresholdKB: number  // 单个 body 超过后写入临时文件
+  previewKB: number         // 写入文件后内存中保留的头尾预览大小
+  memoryBudgetMB: number    // 所有 body 占用内存上限
+  maxBodyMB: number         // 单个 body 最多记录的大小，0 表示不限制
+  spillDir: string          // 为空时使用系统临时目录
+  stats?: BodyStats
+}
+
+export interface BodyStats {
+  memoryBytes: number
+  memoryBudget: number
+  spilledBodies: number
+  spilledBytes: number
+}
+
 /**
  * 统一的 HTTP 请求方法
  * 自动添加正确的 baseUrl
@@ -54,7 +224,7 @@ async function request<T>(path: string, options?: RequestInit): Promise<T> {
   const baseUrl = await getHttpBaseUrl()
   const headers: any = {
     'Content-Type': 'application/json',
-    'Authorization': localStorage.getItem("Authorization") || undefined,
+    'Authorization': `Bearer ${await getApiToken()}`,
     ...options?.headers,
   }
 
@@ -76,6 +246,34 @@ async function request<T>(path: string, options?: RequestInit): Promise<T> {
   }
 }
 
+/**
+ * 下载文件（HAR、会话文件）
+ */
+async function download(path: string, params: URLSearchParams): Promise<Blob> {
+  const response = await fetch(`${await getHttpBaseUrl()}${path}?${params}`, {
+    headers: {'Authorization': `Bearer ${await getApiToken()}`},
+  })
+  if (!response.ok) {
+    throw new Error(await response.text())
+  }
+  return await response.blob()
+}
+
+/**
+ * 选择请求的参数，ids 为空时使用 query 的过滤条件
+ */
+function selectParams(ids?: number[], query: RequestQuery = {}): URLSearchParams {
+  const params = new URLSearchParams()
+  if (ids && ids.length > 0) {
+    params.set('ids', ids.join(','))
+  } else {
+    Object.entries(query).forEach(([key, value]) => {
+      if (value !== undefined && value !== '') params.set(key, String(value))
+    })
+  }
+  return params
+}
+
 /**
  * API 客户端类
  */
@@ -99,6 +297,73 @@ export class ApiClient {
     })
   }
 
+  /**
+   * 启动默认代理监听
+   */
+  static async startProxy(): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/proxy/start', {
+      method: 'POST',
+    })
+  }
+
+  /**
+   * 优雅停止默认代理监听：拒绝新连接，等待进行中的请求完成
+   * @param timeout 最长等待秒数，超时后强制关闭剩余连接
+   */
+  static async stopProxy(timeout?: number): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/proxy/stop', {
+      method: 'POST',
+      body: JSON.stringify({timeout}),
+    })
+  }
+
+  /**
+   * 获取所有代理监听及运行状态
+   */
+  static async getListeners(): Promise<Listener[]> {
+    return request<Listener[]>('/api/listeners')
+  }
+
+  /**
+   * 新增或修改代理监听，保存后按 enabled 启动或停止
+   */
+  static async saveListener(listener: Listener): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/listeners/save', {
+      method: 'POST',
+      body: JSON.stringify(listener),
+    })
+  }
+
+  /**
+   * 启动代理监听
+   */
+  static async startListener(name: string): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/listeners/start', {
+      method: 'POST',
+      body: JSON.stringify({name}),
+    })
+  }
+
+  /**
+   * 停止代理监听
+   */
+  static async stopListener(name: string, timeout?: number): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/listeners/stop', {
+      method: 'POST',
+      body: JSON.stringify({name, timeout}),
+    })
+  }
+
+  /**
+   * 删除代理监听（默认监听不可删除）
+   */
+  static async removeListener(name: string): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/listeners/remove', {
+      method: 'POST',
+      body: JSON.stringify({name}),
+    })
+  }
+
   /**
    * 获取证书状态
    */
@@ -130,7 +395,7 @@ export class ApiClient {
    */
   static async getInstallScriptUrl(): Promise<string> {
     const baseUrl = await getHttpBaseUrl()
-    return `${baseUrl}/api/cert/install-script`
+    return withApiToken(`${baseUrl}/api/cert/install-script`)
   }
 
   /**
@@ -139,7 +404,7 @@ export class ApiClient {
    */
   static async getUninstallScriptUrl(): Promise<string> {
     const baseUrl = await getHttpBaseUrl()
-    return `${baseUrl}/api/cert/uninstall-script`
+    return withApiToken(`${baseUrl}/api/cert/uninstall-script`)
   }
 
   /**
@@ -151,20 +416,260 @@ export class ApiClient {
 
   /**
    * 修改上游代理配置
-   * @param mode 模式 ("none", "env", "custom")
+   * @param mode 模式 ("none", "env", "custom", "pac")
    * @param protocol 协议类型 (http, socket5)
    * @param host 代理服务器主机地址
    * @param port 代理服务器端口
+   * @param pacUrl PAC 文件路径或 URL
    */
   static async changeUpstreamProxyConfig(
     mode: string,
     protocol?: string,
     host?: string,
-    port?: number
+    port?: number,
+    pacUrl?: string
   ): Promise<{ status: boolean; msg?: string }> {
     return request<{ status: boolean; msg?: string }>('/api/proxy/upstream/change', {
       method: 'POST',
-      body: JSON.stringify({mode, protocol, host, port}),
+      body: JSON.stringify({mode, protocol, host, port, pacUrl}),
+    })
+  }
+
+  /**
+   * 获取选择性抓包配置
+   */
+  static async getCaptureConfig(): Promise<CaptureConfig> {
+    return request<CaptureConfig>('/api/capture/config')
+  }
+
+  /**
+   * 修改选择性抓包配置，/proxy.pac 会随之更新
+   * @param includeHosts 需要经过代理的域名
+   * @param excludeHosts 直连的域名
+   */
+  static async changeCaptureConfig(includeHosts: string[], excludeHosts: string[]): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/capture/change', {
+      method: 'POST',
+      body: JSON.stringify({includeHosts, excludeHosts}),
+    })
+  }
+
+  /**
+   * 获取代理认证和访问控制配置
+   */
+  static async getAccessConfig(): Promise<AccessConfig> {
+    return request<AccessConfig>('/api/access/config')
+  }
+
+  /**
+   * 修改代理认证和访问控制配置
+   */
+  static async changeAccessConfig(config: AccessConfig): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/access/change', {
+      method: 'POST',
+      body: JSON.stringify(config),
     })
   }
+
+  /**
+   * 获取最近被拒绝的代理访问
+   */
+  static async getRejectedAttempts(): Promise<RejectedAttempt[]> {
+    return request<RejectedAttempt[]>('/api/access/rejected')
+  }
+
+  /**
+   * 获取持久化存储配置和使用情况
+   */
+  static async getStorageConfig(): Promise<StorageConfig> {
+    return request<StorageConfig>('/api/storage/config')
+  }
+
+  /**
+   * 修改持久化存储配置
+   */
+  static async changeStorageConfig(config: StorageConfig): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/storage/change', {
+      method: 'POST',
+      body: JSON.stringify(config),
+    })
+  }
+
+  /**
+   * 查询抓包记录
+   */
+  static async listRequests(query: RequestQuery = {}): Promise<RequestPage> {
+    const params = new URLSearchParams()
+    Object.entries(query).forEach(([key, value]) => {
+      if (value !== undefined && value !== '') {
+        params.set(key, String(value))
+      }
+    })
+    return request<RequestPage>(`/api/requests?${params.toString()}`)
+  }
+
+  /**
+   * 获取请求的完整内容
+   */
+  static async getRequest(id: number, encoding?: 'utf8' | 'base64'): Promise<RequestDetail> {
+    const suffix = encoding ? `?encoding=${encoding}` : ''
+    return request<RequestDetail>(`/api/requests/${id}${suffix}`)
+  }
+
+  /**
+   * 获取请求记录缓存配置和使用情况
+   */
+  static async getCacheConfig(): Promise<CacheConfig> {
+    return request<CacheConfig>('/api/cache/config')
+  }
+
+  /**
+   * 修改请求记录缓存配置
+   */
+  static async changeCacheConfig(config: CacheConfig): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/cache/change', {
+      method: 'POST',
+      body: JSON.stringify(config),
+    })
+  }
+
+  /**
+   * 固定或取消固定请求，固定的请求不会被移出内存
+   */
+  static async pinRequest(id: number, pinned: boolean): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/cache/pin', {
+      method: 'POST',
+      body: JSON.stringify({ id, pinned }),
+    })
+  }
+
+  /**
+   * 设置请求的标签，替换原有的标签
+   */
+  static async tagRequest(id: number, tags: string[]): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/requests/tags', {
+      method: 'POST',
+      body: JSON.stringify({ id, tags }),
+    })
+  }
+
+  /**
+   * 设置请求的备注，为空时清除
+   */
+  static async notesRequest(id: number, notes: string): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/requests/notes', {
+      method: 'POST',
+      body: JSON.stringify({ id, notes }),
+    })
+  }
+
+  /**
+   * 重放请求，等待所有重放结束后返回每次重放产生的新请求
+   */
+  static async replayRequest(id: number, options: ReplayOptions = {}): Promise<{ status: boolean; msg?: string; results?: SendResult[] }> {
+    return request<{ status: boolean; msg?: string; results?: SendResult[] }>(`/api/requests/${id}/replay`, {
+      method: 'POST',
+      body: JSON.stringify(options),
+    })
+  }
+
+  /**
+   * 将请求生成为 curl 命令或 Go、Python（requests）、fetch() 代码
+   */
+  static async requestCode(id: number, lang: 'curl' | 'go' | 'python' | 'fetch' = 'curl'): Promise<string> {
+    const response = await fetch(`${await getHttpBaseUrl()}/api/requests/${id}/code?lang=${lang}`, {
+      headers: {'Authorization': `Bearer ${await getApiToken()}`},
+    })
+    if (!response.ok) {
+      throw new Error(await response.text())
+    }
+    return await response.text()
+  }
+
+  /**
+   * 发送手工构造的请求，file 不为空时作为请求 body 上传，等待响应结束后返回
+   */
+  static async compose(req: ComposeRequest, file?: Blob): Promise<{ status: boolean; msg?: string; result?: SendResult }> {
+    if (!file) {
+      return request<{ status: boolean; msg?: string; result?: SendResult }>('/api/compose', {
+        method: 'POST',
+        body: JSON.stringify(req),
+      })
+    }
+
+    const form = new FormData()
+    form.append('request', JSON.stringify(req))
+    form.append('body', file)
+    const response = await fetch(`${await getHttpBaseUrl()}/api/compose`, {
+      method: 'POST',
+      headers: {'Authorization': `Bearer ${await getApiToken()}`},
+      body: form,
+    })
+    if (!response.ok) {
+      throw new Error(await response.text())
+    }
+    return await response.json()
+  }
+
+  /**
+   * 导出 HAR，ids 为空时按 query 过滤导出
+   */
+  static async exportHar(ids?: number[], query: RequestQuery = {}): Promise<Blob> {
+    return download('/api/export/har', selectParams(ids, query))
+  }
+
+  /**
+   * 导入 HAR 文件，导入的请求为只读
+   */
+  static async importHar(file: Blob): Promise<{ status: boolean; msg?: string; ids?: number[]; skipped?: number }> {
+    return request<{ status: boolean; msg?: string; ids?: number[]; skipped?: number }>('/api/import/har', {
+      method: 'POST',
+      body: file,
+    })
+  }
+
+  /**
+   * 保存会话文件（.proxyman），包含完整的 body、时间、TLS、标签和备注，ids 为空时按 query 过滤保存
+   */
+  static async saveSession(name: string, ids?: number[], query: RequestQuery = {}): Promise<Blob> {
+    const params = selectParams(ids, query)
+    if (name) params.set('name', name)
+    return download('/api/session/save', params)
+  }
+
+  /**
+   * 打开会话文件，name 为空时使用文件中保存的会话名称
+   */
+  static async loadSession(file: Blob, name?: string): Promise<{ status: boolean; msg?: string; name?: string; ids?: number[] }> {
+    const params = name ? `?${new URLSearchParams({ name })}` : ''
+    return request<{ status: boolean; msg?: string; name?: string; ids?: number[] }>(`/api/session/load${params}`, {
+      method: 'POST',
+      body: file,
+    })
+  }
+
+  /**
+   * 获取 body 缓存配置和内存使用情况
+   */
+  static async getBodyConfig(): Promise<BodyConfig> {
+    return request<BodyConfig>('/api/body/config')
+  }
+
+  /**
+   * 修改 body 缓存配置
+   */
+  static async changeBodyConfig(config: BodyConfig): Promise<{ status: boolean; msg?: string }> {
+    return request<{ status: boolean; msg?: string }>('/api/body/change', {
+      method: 'POST',
+      body: JSON.stringify(config),
+    })
+  }
+
+  /**
+   * 获取 PAC 文件地址
+   */
+  static async getPacUrl(): Promise<string> {
+    const baseUrl = await getHttpBaseUrl()
+    return `${baseUrl || window.location.origin}/proxy.pac`
+  }
 }
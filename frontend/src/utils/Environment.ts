@@ -4,7 +4,7 @@
  */
 
 import {Environment, EnvironmentInfo} from '@/wailsjs/runtime'
-import {GetServerPort} from '@/wailsjs/go/server/App'
+import {GetApiToken, GetServerPort, GetServerScheme} from '@/wailsjs/go/server/App'
 
 /**
  * 检测是否在 Wails 桌面应用环境中运行
@@ -14,9 +14,51 @@ export function isWailsEnvironment(): boolean {
   return typeof window !== 'undefined' && (window as any).runtime !== undefined;
 }
 
+const TOKEN_STORAGE_KEY = 'apiToken'
+
+/**
+ * 获取 Web API 令牌
+ * - Wails 环境：由桌面端直接提供
+ * - Web 环境：首次访问时从 URL 的 ?token= 读取并保存到 localStorage，随后从地址栏移除
+ * @returns {Promise<string>}
+ */
+export async function getApiToken(): Promise<string> {
+  if (isWailsEnvironment()) {
+    try {
+      return await GetApiToken()
+    } catch (error) {
+      console.error('Failed to get api token:', error)
+      return ''
+    }
+  }
+
+  const url = new URL(window.location.href)
+  const token = url.searchParams.get('token')
+  if (token) {
+    localStorage.setItem(TOKEN_STORAGE_KEY, token)
+    url.searchParams.delete('token')
+    window.history.replaceState(null, '', url.toString())
+    return token
+  }
+  return localStorage.getItem(TOKEN_STORAGE_KEY) || ''
+}
+
+/**
+ * 为 URL 附加令牌参数，用于无法设置请求头的 WebSocket 和下载链接
+ * @param {string} url 原始 URL
+ * @returns {Promise<string>}
+ */
+export async function withApiToken(url: string): Promise<string> {
+  const token = await getApiToken()
+  if (!token) {
+    return url
+  }
+  return `${url}${url.includes('?') ? '&' : '?'}token=${encodeURIComponent(token)}`
+}
+
 /**
  * 获取 HTTP API 基础地址
- * - Wails 环境：返回 http://localhost:{port}
+ * - Wails 环境：返回 http(s)://127.0.0.1:{port}
  * - Web 环境：返回空字符串（使用相对路径）
  * @returns {Promise<string>}
  */
@@ -24,7 +66,9 @@ export async function getHttpBaseUrl(): Promise<string> {
   if (isWailsEnvironment()) {
     try {
       const port = await GetServerPort()
-      return `http://localhost:${port}`
+      const scheme = await GetServerScheme()
+      // Web 服务器只监听 127.0.0.1，避免 localhost 解析为 ::1
+      return `${scheme}://127.0.0.1:${port}`
     } catch (error) {
       console.error('Failed to get server port:', error)
       return ''
@@ -35,7 +79,7 @@ export async function getHttpBaseUrl(): Promise<string> {
 
 /**
  * 获取 WebSocket 服务器地址
- * - Wails 环境：返回 ws://localhost:{port}{path}
+ * - Wails 环境：返回 ws(s)://127.0.0.1:{port}{path}
  * - Web 环境：返回相对路径 {path}
  * @param {string} path WebSocket 路径（如 '/ws'）
  * @returns {Promise<string>} 完整的 WebSocket URL
@@ -44,11 +88,12 @@ export async function getWebSocketUrl(path: string): Promise<string> {
   if (isWailsEnvironment()) {
     try {
       const port = await GetServerPort()
-      return `ws://localhost:${port}${path}`
+      const scheme = await GetServerScheme()
+      return `${scheme === 'https' ? 'wss' : 'ws'}://127.0.0.1:${port}${path}`
     } catch (error) {
       console.error('Failed to get WebSocket URL:', error)
       // 降级处理：使用默认端口
-      return `ws://localhost:8080${path}`
+      return `ws://127.0.0.1:8080${path}`
     }
   }
   // Web 环境使用相对路径，浏览器会自动处理
@@ -1,4 +1,8 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function GetApiToken():Promise<string>;
+
 export function GetServerPort():Promise<number>;
+
+export function GetServerScheme():Promise<string>;
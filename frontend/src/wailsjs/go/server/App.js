@@ -2,6 +2,14 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function GetApiToken() {
+  return window['go']['server']['App']['GetApiToken']();
+}
+
 export function GetServerPort() {
   return window['go']['server']['App']['GetServerPort']();
 }
+
+export function GetServerScheme() {
+  return window['go']['server']['App']['GetServerScheme']();
+}
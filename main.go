@@ -3,6 +3,7 @@ package main
 import (
 	"embed"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"proxyMan/server/common"
 	"proxyMan/server/proxy"
 	"proxyMan/server/web"
+	"strings"
 
 	"gopkg.in/natefinch/lumberjack.v2"
 )
@@ -20,31 +22,89 @@ import (
 var assets embed.FS
 
 func main() {
+	// 子命令（export 等）访问正在运行的实例，不启动服务
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	initLogger()
 
 	// 定义命令行参数
 	port := flag.Int("port", 8080, "WebSocket 服务器端口")
+	host := flag.String("host", "127.0.0.1", "Web 管理界面监听地址，默认只允许本机访问")
+	tlsEnabled := flag.Bool("tls", false, "Web 管理界面使用 HTTPS（默认使用 CA 签发的证书）")
+	tlsCert := flag.String("tls-cert", "", "Web 管理界面 HTTPS 证书文件，需同时指定 -tls-key")
+	tlsKey := flag.String("tls-key", "", "Web 管理界面 HTTPS 私钥文件")
+	origins := flag.String("origin", "", "额外信任的 Web 管理界面 Origin，多个用逗号分隔（例如前端开发服务器 http://localhost:3000）")
 	cfg := common.GetConfig()
-	pport := flag.Int("pport", cfg.ProxyPort, "代理服务器端口")
-	phost := flag.String("phost", cfg.ProxyHost, "代理服务器监听地址")
+	defaultListener, _ := common.GetListenerConfig(common.DefaultListener)
+	pport := flag.Int("pport", defaultListener.Port, "默认代理监听端口")
+	phost := flag.String("phost", defaultListener.Host, "默认代理监听地址")
+	rules := flag.String("rules", "", "打印透明代理规则后退出 (iptables 或 nft)")
+	rulesUID := flag.String("rules-uid", "", "透明代理规则只重定向该用户的流量")
+	rulesCgroup := flag.String("rules-cgroup", "", "透明代理规则只重定向该 cgroup v2 路径下的流量")
 	flag.Parse()
 
+	if *rules != "" {
+		printTransparentRules(cfg, *rules, *rulesUID, *rulesCgroup)
+		return
+	}
+
 	cert.InitCA()
 	cert.ClearCertCache() // Clear any cached certificates to use new logic
 
-	err := web.StartWebServer(&assets, *port)
+	// 打开持久化存储，必须在代理开始监听之前，保证新请求的 ID 不与历史记录冲突
+	proxy.InitStorage(cfg.Storage)
+	proxy.InitUpstreamProxy()
+
+	if *origins != "" {
+		common.AddTrustedOrigins(strings.Split(*origins, ",")...)
+	}
+
+	web.EnableTLS = *tlsEnabled || *tlsCert != "" || *tlsKey != ""
+	web.TLSCertFile = *tlsCert
+	web.TLSKeyFile = *tlsKey
+
+	err := web.StartWebServer(&assets, *host, *port)
 	if err != nil {
 		log.Fatalf("Failed to start WebSocket server: %v", err)
 	}
 
-	// 启动代理服务
-	//goland:noinspection GoUnhandledErrorResult
-	go proxy.StartProxy(*phost, *pport)
+	// 启动代理监听，命令行参数只覆盖本次运行的默认监听地址
+	listeners := make([]common.ListenerConfig, 0, len(cfg.Listeners))
+	for _, listener := range cfg.Listeners {
+		if listener.Name == common.DefaultListener {
+			listener.Host = *phost
+			listener.Port = *pport
+		}
+		listeners = append(listeners, listener)
+	}
+	proxy.StartListeners(listeners)
 
 	// 否则尝试启动桌面模式（仅在 wails build 时可用）
 	server.Run(&assets)
 }
 
+// printTransparentRules 打印透明代理所需的 iptables / nft 规则
+func printTransparentRules(cfg *common.Config, format, uid, cgroup string) {
+	opts := proxy.TransparentRuleOptions{
+		Format: format,
+		Port:   8889,
+		UID:    uid,
+		Cgroup: cgroup,
+	}
+	if listener, ok := cfg.FindListener(common.ListenerModeTransparent); ok {
+		opts.Port = listener.Port
+		opts.TProxy = listener.TProxy
+	}
+
+	script, err := proxy.TransparentRules(opts)
+	if err != nil {
+		log.Fatalf("Failed to generate transparent proxy rules: %v", err)
+	}
+	fmt.Print(script)
+}
+
 func initLogger() {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -0,0 +1,206 @@
+// Package codegen 将抓包记录生成为可以重新发送该请求的代码（curl、Go、Python、fetch）
+package codegen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"proxyMan/server/common"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Languages 支持的语言
+var Languages = []string{"curl", "go", "python", "fetch"}
+
+// skipHeaders 不出现在代码中的 header：逐跳头由客户端处理，Content-Length 由 body 决定
+var skipHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Content-Length",
+}
+
+// unsafeFileChars 保存 multipart 文件时文件名中不使用的字符
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// request 生成代码使用的请求
+type request struct {
+	method     string
+	url        string
+	headers    []header
+	body       []byte
+	form       []formPart // multipart/form-data 按字段生成，其他 body 原样发送
+	gzip       bool       // body 发送前重新 gzip 压缩
+	compressed bool       // 原请求接受压缩的响应
+	notes      []string   // 以注释输出的说明
+}
+
+type header struct {
+	name   string
+	values []string
+}
+
+// formPart multipart 的一个字段，filename 不为空时为文件
+type formPart struct {
+	name        string
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// Render 生成指定语言的代码
+func Render(lang string, c *common.HttpContents) (string, error) {
+	req := newRequest(c)
+	switch lang {
+	case "curl":
+		return renderCurl(req), nil
+	case "go":
+		return renderGo(req), nil
+	case "python":
+		return renderPython(req), nil
+	case "fetch":
+		return renderFetch(req), nil
+	}
+	return "", fmt.Errorf("unsupported language %q, must be one of %s", lang, strings.Join(Languages, ", "))
+}
+
+// newRequest 整理请求：记录的请求 body 已解码，gzip 在发送前重新压缩，其他压缩方式去掉 Content-Encoding；
+// Accept-Encoding 交给各语言的客户端处理，由其自动解压响应
+func newRequest(c *common.HttpContents) *request {
+	req := &request{method: c.Method, url: c.URL, body: c.RequestBody}
+	if req.method == "" {
+		req.method = http.MethodGet
+	}
+
+	h := c.RequestHeaders.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	if reason := c.IncompleteRequestBody(); reason != "" {
+		req.notes = append(req.notes, fmt.Sprintf("the request body was not fully recorded (%s)", reason))
+	}
+	switch encoding := strings.ToLower(h.Get("Content-Encoding")); encoding {
+	case "":
+	case "gzip":
+		req.gzip = len(req.body) > 0
+	default:
+		// 注释中不能出现 "coding: xxx"，Python 会当作源文件编码声明
+		req.notes = append(req.notes, fmt.Sprintf("the body is sent uncompressed, the original request was compressed with %s", encoding))
+		h.Del("Content-Encoding")
+	}
+	if h.Get("Accept-Encoding") != "" {
+		req.compressed = true
+		h.Del("Accept-Encoding")
+	}
+	for _, name := range skipHeaders {
+		h.Del(name)
+	}
+	// Host 与 URL 相同时不需要
+	if u, err := url.Parse(c.URL); err == nil && strings.EqualFold(h.Get("Host"), u.Host) {
+		h.Del("Host")
+	}
+
+	if form := parseForm(h.Get("Content-Type"), req.body); form != nil && !req.gzip {
+		req.form = form
+		h.Del("Content-Type")
+	}
+
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		req.headers = append(req.headers, header{name: name, values: h[name]})
+	}
+	return req
+}
+
+// parseForm 解析 multipart/form-data，不是 multipart 或解析失败时返回 nil
+func parseForm(contentType string, body []byte) []formPart {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	form := []formPart{}
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return form
+		}
+		if err != nil || part.FormName() == "" {
+			return nil
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil
+		}
+		form = append(form, formPart{
+			name:        part.FormName(),
+			filename:    part.FileName(),
+			contentType: part.Header.Get("Content-Type"),
+			data:        data,
+		})
+	}
+}
+
+// hasBody 请求是否有 body 或表单
+func (r *request) hasBody() bool {
+	return len(r.body) > 0 || r.form != nil
+}
+
+// value 合并同名 header 的多个值，Cookie 使用分号分隔
+func (h header) value() string {
+	if strings.EqualFold(h.name, "Cookie") {
+		return strings.Join(h.values, "; ")
+	}
+	return strings.Join(h.values, ", ")
+}
+
+// isText 判断数据是否可以作为字符串写在代码中
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, b := range data {
+		if (b < 0x20 && b != '\t' && b != '\n' && b != '\r') || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeBase64(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// localFileName 保存 multipart 文件时使用的本地文件名
+func localFileName(part formPart, index int) string {
+	name := unsafeFileChars.ReplaceAllString(path.Base(strings.ReplaceAll(part.filename, `\`, "/")), "_")
+	if name == "" || name == "." || name == ".." || name == "_" {
+		name = fmt.Sprintf("part%d.bin", index+1)
+	}
+	return name
+}
+
+// quoteEscape 转义双引号中的反斜杠和双引号，与 mime/multipart 的 Content-Disposition 一致
+func quoteEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,83 @@
+package codegen
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// renderCurl 生成 curl 命令。二进制 body 和 multipart 文件先用 base64 解码，避免命令中出现不可打印的字符
+func renderCurl(r *request) string {
+	var b strings.Builder
+	for _, note := range r.notes {
+		fmt.Fprintf(&b, "# %s\n", note)
+	}
+
+	var args []string
+	switch {
+	case r.method == "HEAD":
+		args = append(args, "--head")
+	case r.method == "GET" && !r.hasBody(), r.method == "POST" && r.hasBody():
+	default:
+		args = append(args, "-X "+r.method)
+	}
+	for _, h := range r.headers {
+		for _, value := range h.values {
+			args = append(args, "-H "+shellQuote(h.name+": "+value))
+		}
+	}
+	if r.compressed {
+		args = append(args, "--compressed")
+	}
+
+	prefix := ""
+	switch {
+	case r.form != nil:
+		used := map[string]bool{}
+		for i, part := range r.form {
+			if part.filename == "" && isText(part.data) && !strings.Contains(part.name, "=") {
+				args = append(args, "--form-string "+shellQuote(part.name+"="+string(part.data)))
+				continue
+			}
+
+			file := localFileName(part, i)
+			if used[file] {
+				file = fmt.Sprintf("%d_%s", i+1, file)
+			}
+			used[file] = true
+			fmt.Fprintf(&b, "echo %s | base64 -d > %s\n", shellQuote(encodeBase64(part.data)), shellQuote(file))
+
+			if part.filename == "" {
+				// < 读取文件内容作为普通字段
+				args = append(args, "-F "+shellQuote(fmt.Sprintf(`%s=<"%s"`, part.name, file)))
+				continue
+			}
+			field := fmt.Sprintf(`%s=@"%s";filename="%s"`, part.name, file, quoteEscape(part.filename))
+			// type 中不能包含参数（例如 charset），只保留媒体类型
+			if mediaType, _, err := mime.ParseMediaType(part.contentType); err == nil {
+				field += ";type=" + mediaType
+			}
+			args = append(args, "-F "+shellQuote(field))
+		}
+	case r.gzip:
+		prefix = "echo " + shellQuote(encodeBase64(r.body)) + " | base64 -d | gzip -c | "
+		args = append(args, "--data-binary @-")
+	case len(r.body) > 0 && isText(r.body):
+		args = append(args, "--data-raw "+shellQuote(string(r.body)))
+	case len(r.body) > 0:
+		prefix = "echo " + shellQuote(encodeBase64(r.body)) + " | base64 -d | "
+		args = append(args, "--data-binary @-")
+	}
+
+	b.WriteString(prefix + "curl " + shellQuote(r.url))
+	for _, arg := range args {
+		b.WriteString(" \\\n  " + arg)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// shellQuote 使用单引号引用，单引号写作 '\”
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
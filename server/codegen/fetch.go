@@ -0,0 +1,94 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// browserForbiddenHeaders 浏览器不允许 fetch 设置的 header，Node.js 中有效；Host 两者都不允许设置
+var browserForbiddenHeaders = []string{"Cookie", "Origin", "Referer", "User-Agent"}
+
+// renderFetch 生成 fetch() 调用。同名 header 合并为一个值；Cookie 等 header 在浏览器中会被忽略，以注释说明
+func renderFetch(r *request) string {
+	bytesLiteral := func(data []byte) string {
+		return fmt.Sprintf("Uint8Array.from(atob(%s), (c) => c.charCodeAt(0))", jsString(encodeBase64(data)))
+	}
+
+	var b strings.Builder
+	for _, note := range r.notes {
+		fmt.Fprintf(&b, "// %s\n", note)
+	}
+	for _, h := range r.headers {
+		if h.name == "Host" {
+			b.WriteString("// fetch cannot override the Host header, the request is sent with the host of the URL\n")
+		} else if slices.ContainsFunc(browserForbiddenHeaders, func(name string) bool { return strings.EqualFold(name, h.name) }) {
+			fmt.Fprintf(&b, "// %s is ignored by browsers, it only takes effect in Node.js\n", h.name)
+		}
+	}
+
+	bodyValue := ""
+	switch {
+	case r.form != nil:
+		bodyValue = "form"
+		b.WriteString("const form = new FormData();\n")
+		for _, part := range r.form {
+			if part.filename == "" && part.contentType == "" && isText(part.data) {
+				fmt.Fprintf(&b, "form.append(%s, %s);\n", jsString(part.name), jsString(string(part.data)))
+				continue
+			}
+			content := jsString(string(part.data))
+			if !isText(part.data) {
+				content = bytesLiteral(part.data)
+			}
+			blob := fmt.Sprintf("new Blob([%s])", content)
+			if part.contentType != "" {
+				blob = fmt.Sprintf("new Blob([%s], { type: %s })", content, jsString(part.contentType))
+			}
+			if part.filename != "" {
+				fmt.Fprintf(&b, "form.append(%s, %s, %s);\n", jsString(part.name), blob, jsString(part.filename))
+			} else {
+				fmt.Fprintf(&b, "form.append(%s, %s);\n", jsString(part.name), blob)
+			}
+		}
+		b.WriteString("\n")
+	case r.gzip:
+		bodyValue = "body"
+		content := jsString(string(r.body))
+		if !isText(r.body) {
+			content = bytesLiteral(r.body)
+		}
+		fmt.Fprintf(&b, "const body = await new Response(new Blob([%s]).stream().pipeThrough(new CompressionStream(\"gzip\"))).arrayBuffer();\n\n", content)
+	case len(r.body) > 0 && isText(r.body):
+		bodyValue = jsString(string(r.body))
+	case len(r.body) > 0:
+		bodyValue = bytesLiteral(r.body)
+	}
+
+	fmt.Fprintf(&b, "const response = await fetch(%s, {\n", jsString(r.url))
+	fmt.Fprintf(&b, "  method: %s,\n", jsString(r.method))
+	if len(r.headers) > 0 {
+		b.WriteString("  headers: {\n")
+		for _, h := range r.headers {
+			fmt.Fprintf(&b, "    %s: %s,\n", jsString(h.name), jsString(h.value()))
+		}
+		b.WriteString("  },\n")
+	}
+	if bodyValue != "" {
+		fmt.Fprintf(&b, "  body: %s,\n", bodyValue)
+	}
+	b.WriteString("});\n")
+	b.WriteString("console.log(response.status);\nconsole.log(await response.text());\n")
+	return b.String()
+}
+
+// jsString 生成双引号的 JavaScript 字符串
+func jsString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,137 @@
+package codegen
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// renderGo 生成使用 net/http 的完整程序。不设置 Accept-Encoding，由 Transport 自动请求并解压 gzip
+func renderGo(r *request) string {
+	imports := []string{"fmt", "io", "net/http"}
+	var body strings.Builder
+	needDecode := false
+	bytesLiteral := func(data []byte) string {
+		if isText(data) {
+			return "[]byte(" + goString(string(data)) + ")"
+		}
+		needDecode = true
+		return "mustDecode(" + strconv.Quote(encodeBase64(data)) + ")"
+	}
+
+	reader := "nil"
+	switch {
+	case r.form != nil:
+		imports = append(imports, "bytes", "mime/multipart")
+		reader = "&form"
+		body.WriteString("\tvar form bytes.Buffer\n")
+		body.WriteString("\twriter := multipart.NewWriter(&form)\n")
+		partDeclared := false
+		for _, part := range r.form {
+			if part.filename == "" && part.contentType == "" && isText(part.data) {
+				fmt.Fprintf(&body, "\tif err := writer.WriteField(%s, %s); err != nil {\n\t\tpanic(err)\n\t}\n",
+					strconv.Quote(part.name), goString(string(part.data)))
+				continue
+			}
+
+			if !slices.Contains(imports, "net/textproto") {
+				imports = append(imports, "net/textproto")
+			}
+			disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscape(part.name))
+			if part.filename != "" {
+				disposition += fmt.Sprintf(`; filename="%s"`, quoteEscape(part.filename))
+			}
+			assign := ":="
+			if partDeclared {
+				assign = "="
+			}
+			partDeclared = true
+			fmt.Fprintf(&body, "\tpart, err %s writer.CreatePart(textproto.MIMEHeader{\n", assign)
+			fmt.Fprintf(&body, "\t\t\"Content-Disposition\": {%s},\n", strconv.Quote(disposition))
+			if part.contentType != "" {
+				fmt.Fprintf(&body, "\t\t\"Content-Type\":        {%s},\n", strconv.Quote(part.contentType))
+			}
+			body.WriteString("\t})\n\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+			fmt.Fprintf(&body, "\tif _, err := part.Write(%s); err != nil {\n\t\tpanic(err)\n\t}\n", bytesLiteral(part.data))
+		}
+		body.WriteString("\tif err := writer.Close(); err != nil {\n\t\tpanic(err)\n\t}\n\n")
+	case r.gzip:
+		imports = append(imports, "bytes", "compress/gzip")
+		reader = "&compressed"
+		body.WriteString("\tvar compressed bytes.Buffer\n")
+		body.WriteString("\tgz := gzip.NewWriter(&compressed)\n")
+		fmt.Fprintf(&body, "\tif _, err := gz.Write(%s); err != nil {\n\t\tpanic(err)\n\t}\n", bytesLiteral(r.body))
+		body.WriteString("\tif err := gz.Close(); err != nil {\n\t\tpanic(err)\n\t}\n\n")
+	case len(r.body) > 0 && isText(r.body):
+		imports = append(imports, "strings")
+		reader = "strings.NewReader(" + goString(string(r.body)) + ")"
+	case len(r.body) > 0:
+		imports = append(imports, "bytes")
+		reader = "bytes.NewReader(" + bytesLiteral(r.body) + ")"
+	}
+	if needDecode {
+		imports = append(imports, "encoding/base64")
+	}
+	slices.Sort(imports)
+
+	var b strings.Builder
+	for _, note := range r.notes {
+		fmt.Fprintf(&b, "// %s\n", note)
+	}
+	b.WriteString("package main\n\nimport (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "\t%q\n", imp)
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+	b.WriteString(body.String())
+	fmt.Fprintf(&b, "\treq, err := http.NewRequest(%s, %s, %s)\n", strconv.Quote(r.method), strconv.Quote(r.url), reader)
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, h := range r.headers {
+		if h.name == "Host" {
+			fmt.Fprintf(&b, "\treq.Host = %s\n", strconv.Quote(h.values[0]))
+			continue
+		}
+		for _, value := range h.values {
+			fmt.Fprintf(&b, "\treq.Header.Add(%s, %s)\n", strconv.Quote(h.name), strconv.Quote(value))
+		}
+	}
+	if r.form != nil {
+		b.WriteString("\treq.Header.Set(\"Content-Type\", writer.FormDataContentType())\n")
+	}
+	b.WriteString(`
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(resp.Status)
+	fmt.Println(string(respBody))
+}
+`)
+	if needDecode {
+		b.WriteString(`
+func mustDecode(s string) []byte {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+`)
+	}
+	return b.String()
+}
+
+// goString 多行文本使用反引号，其他使用双引号
+func goString(s string) string {
+	if strings.Contains(s, "\n") && !strings.ContainsAny(s, "`\r") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,98 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renderPython 生成使用 requests 的代码。同名 header 合并为一个值，multipart 全部字段通过 files 按原顺序发送
+func renderPython(r *request) string {
+	imports := []string{"requests"}
+	bytesLiteral := func(data []byte) string {
+		if isText(data) {
+			return pyString(string(data)) + ".encode()"
+		}
+		if imports[0] != "base64" {
+			imports = append([]string{"base64"}, imports...)
+		}
+		return "base64.b64decode(" + pyString(encodeBase64(data)) + ")"
+	}
+
+	var body strings.Builder
+	args := []string{pyString(r.method), "url", "headers=headers"}
+	switch {
+	case r.form != nil:
+		args = append(args, "files=files")
+		body.WriteString("files = [\n")
+		for _, part := range r.form {
+			filename := "None"
+			if part.filename != "" {
+				filename = pyString(part.filename)
+			}
+			content := pyString(string(part.data))
+			if !isText(part.data) {
+				content = bytesLiteral(part.data)
+			}
+			if part.contentType != "" {
+				fmt.Fprintf(&body, "    (%s, (%s, %s, %s)),\n", pyString(part.name), filename, content, pyString(part.contentType))
+			} else {
+				fmt.Fprintf(&body, "    (%s, (%s, %s)),\n", pyString(part.name), filename, content)
+			}
+		}
+		body.WriteString("]\n")
+	case r.gzip:
+		args = append(args, "data=data")
+		data := bytesLiteral(r.body)
+		imports = append([]string{"gzip"}, imports...)
+		fmt.Fprintf(&body, "data = gzip.compress(%s)\n", data)
+	case len(r.body) > 0:
+		args = append(args, "data=data")
+		fmt.Fprintf(&body, "data = %s\n", bytesLiteral(r.body))
+	}
+
+	var b strings.Builder
+	for _, note := range r.notes {
+		fmt.Fprintf(&b, "# %s\n", note)
+	}
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "import %s\n", imp)
+	}
+	fmt.Fprintf(&b, "\nurl = %s\n", pyString(r.url))
+	b.WriteString("headers = {\n")
+	for _, h := range r.headers {
+		fmt.Fprintf(&b, "    %s: %s,\n", pyString(h.name), pyString(h.value()))
+	}
+	b.WriteString("}\n")
+	b.WriteString(body.String())
+	fmt.Fprintf(&b, "\nresponse = requests.request(%s)\n", strings.Join(args, ", "))
+	b.WriteString("print(response.status_code)\nprint(response.text)\n")
+	return b.String()
+}
+
+// pyString 生成单引号的 Python 字符串，控制字符使用转义
+func pyString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, c := range s {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f || c == 0x2028 || c == 0x2029 {
+				fmt.Fprintf(&b, `\u%04x`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -1,30 +1,187 @@
 package common
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
 // Config 应用配置结构
 type Config struct {
-	// 代理服务器配置
-	ProxyHost string `json:"proxy_host"`
-	ProxyPort int    `json:"proxy_port"`
+	// 代理监听配置，可同时开启多个
+	Listeners []ListenerConfig `json:"listeners"`
 
 	// 上游代理配置
 	UpstreamProxy UpstreamProxyConfig `json:"upstream_proxy"`
+
+	// 选择性抓包配置
+	Capture CaptureConfig `json:"capture"`
+
+	// 代理认证和客户端访问控制
+	Access AccessConfig `json:"access"`
+
+	// 抓包记录持久化存储
+	Storage StorageConfig `json:"storage"`
+
+	// 请求和响应 body 的内存限制
+	Body BodyConfig `json:"body"`
+
+	// 内存中保留的请求记录
+	Cache CacheConfig `json:"cache"`
+
+	// Web 管理界面 API 令牌，首次启动时自动生成
+	APIToken string `json:"api_token"`
+}
+
+const (
+	ListenerModeHTTP        = "http"        // HTTP/HTTPS 代理
+	ListenerModeSocks       = "socks"       // SOCKS5/SOCKS4a 代理
+	ListenerModeTransparent = "transparent" // 透明代理（仅 Linux）
+	ListenerModeReverse     = "reverse"     // 反向代理
+
+	// DefaultListener 默认的 HTTP 代理监听，不可删除
+	DefaultListener = "default"
+)
+
+// ListenerConfig 代理监听配置，抓取的请求会标记所属监听的名称
+type ListenerConfig struct {
+	Name    string `json:"name"`
+	Label   string `json:"label,omitempty"`
+	Mode    string `json:"mode"` // http, socks, transparent, reverse
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	Enabled bool   `json:"enabled"`
+
+	// 透明代理：使用 TPROXY 而不是 REDIRECT
+	TProxy bool `json:"tproxy,omitempty"`
+
+	// 反向代理：后端地址（例如 http://localhost:3000），以及是否使用 CA 签发的证书终止 TLS
+	Target string `json:"target,omitempty"`
+	TLS    bool   `json:"tls,omitempty"`
+}
+
+// legacyConfig 旧版本的单监听配置，加载时迁移到 Listeners
+type legacyConfig struct {
+	Listeners json.RawMessage `json:"listeners"`
+
+	ProxyHost string `json:"proxy_host"`
+	ProxyPort int    `json:"proxy_port"`
+}
+
+// migrate 将旧版本的代理地址转换为默认监听
+func (l *legacyConfig) migrate() []ListenerConfig {
+	host, port := "127.0.0.1", 8888
+	if l.ProxyHost != "" {
+		host = l.ProxyHost
+	}
+	if l.ProxyPort != 0 {
+		port = l.ProxyPort
+	}
+	return []ListenerConfig{
+		{Name: DefaultListener, Mode: ListenerModeHTTP, Host: host, Port: port, Enabled: true},
+	}
+}
+
+// CaptureConfig 选择性抓包的域名列表
+// 域名可以是精确域名（同时匹配其子域名），也可以是 shell 通配符，例如 *.example.com
+type CaptureConfig struct {
+	IncludeHosts []string `json:"include_hosts"` // 为空表示抓取全部域名
+	ExcludeHosts []string `json:"exclude_hosts"` // 优先级高于 IncludeHosts
+}
+
+// MatchHost 判断域名是否匹配规则，选择性抓包（PAC）和请求筛选共用同一规则：
+// 规则含通配符时按 shell 通配符匹配，例如 *.example.com，否则匹配该域名及其子域名。host 可以带端口
+func MatchHost(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if strings.ContainsAny(pattern, "*?[") {
+		matched, _ := path.Match(pattern, host)
+		return matched
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+// AccessConfig 代理认证和客户端访问控制，对所有代理监听生效
+type AccessConfig struct {
+	// 开启后 HTTP 代理需要 Proxy-Authorization Basic 认证，SOCKS5 需要用户名/密码认证
+	AuthEnabled bool   `json:"auth_enabled"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+
+	// 允许连接的客户端网段（CIDR 或单个 IP），为空表示不限制，本机连接始终允许
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+}
+
+// StorageConfig 抓包记录持久化配置，保留限制为 0 表示不限制
+type StorageConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Dir         string `json:"dir"` // 为空时使用 ~/.proxyMan/data
+	MaxCount    int    `json:"max_count"`
+	MaxAgeHours int    `json:"max_age_hours"`
+	MaxSizeMB   int    `json:"max_size_mb"`
+}
+
+// 请求记录的淘汰顺序
+const (
+	CacheEvictionLRU = "lru" // 最久未查看的先淘汰
+	CacheEvictionAge = "age" // 最早捕获的先淘汰
+)
+
+// CacheConfig 内存中保留的请求记录上限，0 表示不限制。
+// 超出时按 Eviction 顺序淘汰已结束且未固定的请求，启用持久化存储时被淘汰的请求仍可从磁盘读取
+type CacheConfig struct {
+	MaxCount  int    `json:"max_count"`
+	MaxSizeMB int    `json:"max_size_mb"` // 按请求和响应 body 的总大小计算
+	Eviction  string `json:"eviction"`
+}
+
+// BodyConfig 请求和响应 body 的缓存配置：
+// 单个 body 超过 SpillThresholdKB 或所有 body 占用内存超过 MemoryBudgetMB 时写入临时文件，内存中只保留头尾预览
+type BodyConfig struct {
+	SpillThresholdKB int    `json:"spill_threshold_kb"`
+	PreviewKB        int    `json:"preview_kb"`       // 写入文件后内存中保留的头部和尾部大小
+	MemoryBudgetMB   int    `json:"memory_budget_mb"` // 0 表示所有 body 都写入文件
+	MaxBodyMB        int    `json:"max_body_mb"`      // 单个 body 最多记录的大小，0 表示不限制
+	SpillDir         string `json:"spill_dir"`        // 为空时使用系统临时目录
+}
+
+// SpillDirPath 返回临时文件目录
+func (c BodyConfig) SpillDirPath() string {
+	if c.SpillDir != "" {
+		return c.SpillDir
+	}
+	return filepath.Join(os.TempDir(), "proxyMan")
+}
+
+// StorageDir 返回存储目录
+func (c StorageConfig) StorageDir() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	return filepath.Join(filepath.Dir(configPath), "data")
 }
 
 // UpstreamProxyConfig 上游代理配置
 type UpstreamProxyConfig struct {
-	// Mode: "none" - 不使用上游代理, "env" - 使用环境变量, "custom" - 自定义代理
+	// Mode: "none" - 不使用上游代理, "env" - 使用环境变量, "custom" - 自定义代理, "pac" - PAC 脚本
 	Mode     string `json:"mode"`
 	Protocol string `json:"protocol"` // http, socket5
 	Host     string `json:"host"`
 	Port     int    `json:"port"`
+	PacURL   string `json:"pac_url"` // PAC 文件路径或 URL，仅 pac 模式使用
 }
 
 var (
@@ -60,11 +217,30 @@ func init() {
 // getDefaultConfig 获取默认配置
 func getDefaultConfig() *Config {
 	return &Config{
-		ProxyHost: "127.0.0.1",
-		ProxyPort: 8888,
+		Listeners: []ListenerConfig{
+			{Name: DefaultListener, Mode: ListenerModeHTTP, Host: "127.0.0.1", Port: 8888, Enabled: true},
+		},
 		UpstreamProxy: UpstreamProxyConfig{
 			Mode: "none",
 		},
+		Storage: StorageConfig{
+			// 记录包含完整的请求和响应（可能有凭据），需要用户主动开启
+			Enabled:     false,
+			MaxCount:    100000,
+			MaxAgeHours: 7 * 24,
+			MaxSizeMB:   1024,
+		},
+		Cache: CacheConfig{
+			MaxCount:  1000,
+			MaxSizeMB: 1024,
+			Eviction:  CacheEvictionLRU,
+		},
+		Body: BodyConfig{
+			SpillThresholdKB: 1024,
+			PreviewKB:        64,
+			MemoryBudgetMB:   256,
+			MaxBodyMB:        100,
+		},
 	}
 }
 
@@ -74,6 +250,7 @@ func loadConfig() error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			appConfig = getDefaultConfig()
+			appConfig.APIToken = generateToken()
 			err = saveConfig()
 			if err != nil {
 				log.Fatal("can not save config ", err)
@@ -83,14 +260,45 @@ func loadConfig() error {
 		return err
 	}
 
-	appConfig = &Config{}
+	// 以默认配置为基础解析，旧版本配置文件中缺失的字段使用默认值
+	appConfig = getDefaultConfig()
 	if err := json.Unmarshal(data, appConfig); err != nil {
 		return err
 	}
 
+	changed := false
+
+	// 旧版本配置没有 listeners 字段，迁移单监听配置
+	legacy := &legacyConfig{}
+	if err := json.Unmarshal(data, legacy); err != nil {
+		return err
+	}
+	if len(legacy.Listeners) == 0 {
+		appConfig.Listeners = legacy.migrate()
+		log.Printf("Migrated proxy listener from legacy config")
+		changed = true
+	}
+
+	if appConfig.APIToken == "" {
+		appConfig.APIToken = generateToken()
+		changed = true
+	}
+
+	if changed {
+		return saveConfig()
+	}
 	return nil
 }
 
+// generateToken 生成随机的 API 令牌
+func generateToken() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatalf("Failed to generate api token: %v", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
 // saveConfig 保存配置文件
 func saveConfig() error {
 	data, err := json.MarshalIndent(appConfig, "", "  ")
@@ -98,7 +306,11 @@ func saveConfig() error {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	// 配置中包含 API 令牌和代理密码，只允许当前用户读取
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(configPath, 0600)
 }
 
 // GetConfig 获取配置
@@ -111,14 +323,54 @@ func GetConfig() *Config {
 	return &config
 }
 
-// UpdateProxyConfig 更新代理配置
-func UpdateProxyConfig(host string, port int) error {
+// GetListenerConfig 获取指定名称的监听配置
+func GetListenerConfig(name string) (ListenerConfig, bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	for _, listener := range appConfig.Listeners {
+		if listener.Name == name {
+			return listener, true
+		}
+	}
+	return ListenerConfig{}, false
+}
+
+// SaveListenerConfig 新增或更新监听配置
+func SaveListenerConfig(config ListenerConfig) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	listeners := make([]ListenerConfig, 0, len(appConfig.Listeners)+1)
+	found := false
+	for _, listener := range appConfig.Listeners {
+		if listener.Name == config.Name {
+			listener = config
+			found = true
+		}
+		listeners = append(listeners, listener)
+	}
+	if !found {
+		listeners = append(listeners, config)
+	}
+
+	appConfig.Listeners = listeners
+	return saveConfig()
+}
+
+// RemoveListenerConfig 删除监听配置
+func RemoveListenerConfig(name string) error {
 	configLock.Lock()
 	defer configLock.Unlock()
 
-	appConfig.ProxyHost = host
-	appConfig.ProxyPort = port
+	listeners := make([]ListenerConfig, 0, len(appConfig.Listeners))
+	for _, listener := range appConfig.Listeners {
+		if listener.Name != name {
+			listeners = append(listeners, listener)
+		}
+	}
 
+	appConfig.Listeners = listeners
 	return saveConfig()
 }
 
@@ -130,3 +382,58 @@ func UpdateUpstreamProxyConfig(config UpstreamProxyConfig) error {
 	appConfig.UpstreamProxy = config
 	return saveConfig()
 }
+
+// UpdateAccessConfig 更新代理认证和访问控制配置
+func UpdateAccessConfig(config AccessConfig) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	appConfig.Access = config
+	return saveConfig()
+}
+
+// UpdateCacheConfig 更新请求记录缓存配置
+func UpdateCacheConfig(config CacheConfig) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	appConfig.Cache = config
+	return saveConfig()
+}
+
+// UpdateBodyConfig 更新 body 缓存配置
+func UpdateBodyConfig(config BodyConfig) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	appConfig.Body = config
+	return saveConfig()
+}
+
+// UpdateStorageConfig 更新持久化存储配置
+func UpdateStorageConfig(config StorageConfig) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	appConfig.Storage = config
+	return saveConfig()
+}
+
+// UpdateCaptureConfig 更新选择性抓包配置
+func UpdateCaptureConfig(config CaptureConfig) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	appConfig.Capture = config
+	return saveConfig()
+}
+
+// FindListener 返回第一个指定模式的监听配置
+func (c *Config) FindListener(mode string) (ListenerConfig, bool) {
+	for _, listener := range c.Listeners {
+		if listener.Mode == mode {
+			return listener, true
+		}
+	}
+	return ListenerConfig{}, false
+}
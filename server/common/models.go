@@ -1,9 +1,13 @@
 package common
 
 import (
+	"crypto/tls"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -33,6 +37,7 @@ type RequestSummary struct {
 	StartTime *time.Time    `json:"startTime"`
 	EndTime   *time.Time    `json:"endTime"`
 	Status    RequestStatus `json:"status"`
+	Listener  string        `json:"listener"` // 捕获该请求的监听名称
 	//请求数据
 	Method string `json:"method"`
 	Host   string `json:"host"`
@@ -40,6 +45,23 @@ type RequestSummary struct {
 	//响应数据
 	ContentType string `json:"contentType"`
 	StatusCode  int    `json:"statusCode"`
+	// body 超过记录上限，只保存了前面的部分
+	BodyTruncated bool `json:"bodyTruncated,omitempty"`
+	// 固定的请求不会被移出内存缓存
+	Pinned bool `json:"pinned,omitempty"`
+	// 用户添加的标签
+	Tags []string `json:"tags,omitempty"`
+	// 从 HAR 等外部文件导入，不是本机捕获的请求
+	Imported bool `json:"imported,omitempty"`
+	// 从会话文件打开的请求所属的会话名称
+	Session string `json:"session,omitempty"`
+	// 重放产生的请求对应的原请求 ID
+	ReplayOf int64 `json:"replayOf,omitempty"`
+}
+
+// CoalesceKey 同一请求排队中的多次状态更新只推送最新的一次
+func (s RequestSummary) CoalesceKey() any {
+	return s.ID
 }
 
 // HttpContents contains all captured details of a request-response cycle
@@ -49,6 +71,66 @@ type HttpContents struct {
 	RequestBody     []byte      `json:"requestBody"`
 	ResponseHeaders http.Header `json:"responseHeaders"`
 	ResponseBody    []byte      `json:"responseBody"` // 改为字节数组以支持二进制数据
+	Error           string      `json:"error,omitempty"`
+	Timing          Timing      `json:"timing"`
+	TLS             *TLSInfo    `json:"tls,omitempty"` // 与目标服务器的 TLS 连接，明文请求为 nil
+	Notes           string      `json:"notes,omitempty"`
+	// 请求 body 超过记录上限，BodyTruncated 不区分请求和响应
+	RequestBodyTruncated bool `json:"requestBodyTruncated,omitempty"`
+}
+
+// IncompleteRequestBody 说明记录的请求 body 为什么不完整，完整时返回空字符串。
+// 记录的 body 已解码，只有没有 Content-Encoding 时才能与 Content-Length 比较，
+// 压缩的 body 在发送完之前出错时按出错状态判断
+func (c *HttpContents) IncompleteRequestBody() string {
+	if c.RequestBodyTruncated {
+		return fmt.Sprintf("only the first %d bytes were recorded", len(c.RequestBody))
+	}
+	if c.RequestHeaders.Get("Content-Encoding") == "" {
+		if length, err := strconv.Atoi(c.RequestHeaders.Get("Content-Length")); err == nil && length != len(c.RequestBody) {
+			return fmt.Sprintf("%d of %d bytes", len(c.RequestBody), length)
+		}
+	} else if c.Status == StatusError && c.Timing.RequestSent == nil {
+		return fmt.Sprintf("the request failed after %d bytes", len(c.RequestBody))
+	}
+	return ""
+}
+
+// Timing 请求各阶段的时间点，开始和结束时间在 RequestSummary 中
+type Timing struct {
+	RequestSent   *time.Time `json:"requestSent,omitempty"`   // 请求 body 发送完成
+	ResponseStart *time.Time `json:"responseStart,omitempty"` // 收到响应头
+}
+
+// TLSInfo 与目标服务器的 TLS 连接信息
+type TLSInfo struct {
+	Version            string    `json:"version"`
+	CipherSuite        string    `json:"cipherSuite"`
+	ServerName         string    `json:"serverName,omitempty"`
+	NegotiatedProtocol string    `json:"negotiatedProtocol,omitempty"`
+	CertSubject        string    `json:"certSubject,omitempty"`
+	CertIssuer         string    `json:"certIssuer,omitempty"`
+	CertNotAfter       time.Time `json:"certNotAfter,omitzero"`
+}
+
+// NewTLSInfo 从连接状态中提取 TLS 信息
+func NewTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+	info := &TLSInfo{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		ServerName:         state.ServerName,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		info.CertSubject = leaf.Subject.String()
+		info.CertIssuer = leaf.Issuer.String()
+		info.CertNotAfter = leaf.NotAfter
+	}
+	return info
 }
 
 // DataChunk represents a chunk of response data for streaming
@@ -58,6 +140,35 @@ type DataChunk struct {
 	//每种DataType都只有一条Finished为 ture 的消息
 	Finished  bool      `json:"finished"`
 	Timestamp time.Time `json:"timestamp"`
+	// Data 在 body 中的偏移量，只对 RequestBody 和 ResponseBody 有意义
+	Offset int64 `json:"offset"`
+}
+
+// dataChunkHeader 二进制帧中 DataChunk 除 Data 以外的部分
+type dataChunkHeader struct {
+	DataType  DataType  `json:"dataType"`
+	Finished  bool      `json:"finished"`
+	Timestamp time.Time `json:"timestamp"`
+	Offset    int64     `json:"offset"`
+}
+
+// MarshalBinary 编码为二进制帧：4 字节大端序的头部长度、JSON 头部、原始数据，避免 base64 的额外开销
+func (dc *DataChunk) MarshalBinary() ([]byte, error) {
+	header, err := json.Marshal(dataChunkHeader{
+		DataType:  dc.DataType,
+		Finished:  dc.Finished,
+		Timestamp: dc.Timestamp,
+		Offset:    dc.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 4+len(header)+len(dc.Data))
+	binary.BigEndian.PutUint32(frame, uint32(len(header)))
+	copy(frame[4:], header)
+	copy(frame[4+len(header):], dc.Data)
+	return frame, nil
 }
 
 // MarshalJSON customizes JSON serialization to handle binary data properly
@@ -0,0 +1,67 @@
+package common
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Wails 桌面端 WebView 使用的 Origin
+var wailsOrigins = []string{
+	"wails://wails",
+	"wails://wails.localhost",
+	"http://wails.localhost",
+	"https://wails.localhost",
+}
+
+var (
+	trustedOrigins     []string
+	trustedOriginsLock sync.RWMutex
+)
+
+// AddTrustedOrigins 添加额外信任的 Origin，例如前端开发服务器 http://localhost:3000
+func AddTrustedOrigins(origins ...string) {
+	trustedOriginsLock.Lock()
+	defer trustedOriginsLock.Unlock()
+
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+		if origin != "" {
+			trustedOrigins = append(trustedOrigins, origin)
+		}
+	}
+}
+
+// IsAllowedOrigin 判断请求的 Origin 是否可信：
+// 没有 Origin（非浏览器客户端）、同源、Wails WebView 以及额外信任的 Origin
+func IsAllowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+	for _, trusted := range wailsOrigins {
+		if origin == trusted || strings.HasPrefix(origin, trusted+":") {
+			return true
+		}
+	}
+
+	trustedOriginsLock.RLock()
+	defer trustedOriginsLock.RUnlock()
+	for _, trusted := range trustedOrigins {
+		if origin == trusted {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,13 @@
 package common
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -15,111 +20,446 @@ var (
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有 Origin
-	},
+	// 拒绝其他网站发起的跨站 WebSocket 连接
+	CheckOrigin: IsAllowedOrigin,
 }
 
+const (
+	// 保留最近的广播事件数量，断线重连的客户端可以从中补发
+	wsHistorySize = 1000
+	// 每个客户端最多排队的消息数量，超出时重新发送快照（没有快照时丢弃最旧的消息）
+	wsQueueSize    = 256
+	wsPingInterval = 30 * time.Second
+)
+
+// WebSocket 广播消息类型
+const (
+	WsMessageEvent    = "event"    // 单条事件，Data 为广播的内容
+	WsMessageSnapshot = "snapshot" // 连接时、修改订阅条件后或客户端落后太多时的快照，Data 为 SnapshotFunc 的返回值
+	WsMessageError    = "error"    // 客户端消息无效，Data 为错误信息
+)
+
+// 客户端发送的消息类型
+const (
+	WsClientFilter = "filter" // 修改订阅条件，Filter 为 FilterFunc 解析的内容，null 表示不过滤
+)
+
+// wsClientMessage 客户端发送的消息
+type wsClientMessage struct {
+	Type   string          `json:"type"`
+	Filter json.RawMessage `json:"filter"`
+}
+
+// WsMessage 广播消息。Seq 为事件序号，每个事件加一，快照的 Seq 为快照对应的最后一个事件；
+// Prev 为发给该客户端的上一条消息的 Seq。同一对象的多次更新在排队时会被合并，所以 Seq 可能跳跃，
+// 客户端发现 Prev 与最后收到的 Seq 不一致时应带上最后收到的 Seq 重新连接
+type WsMessage struct {
+	Type string `json:"type"`
+	Seq  int64  `json:"seq"`
+	Prev int64  `json:"prev"`
+	Data any    `json:"data"`
+}
+
+// Coalescer 可以合并的广播内容，客户端队列中相同 key 的旧消息会被新消息替换
+type Coalescer interface {
+	CoalesceKey() any
+}
+
+// WsFilter 客户端的订阅条件，只推送匹配的内容
+type WsFilter interface {
+	Match(data any) bool
+}
+
+// FilterFunc 解析客户端的订阅条件，返回 nil 表示不过滤
+type FilterFunc func(data []byte) (WsFilter, error)
+
+// SnapshotFunc 生成快照，since 为客户端提供的最后收到的 ID（?since=），没有时为 0；filter 为客户端的订阅条件，可能为 nil
+type SnapshotFunc func(r *http.Request, since int64, filter WsFilter) any
+
+// handleRequest 独占连接的处理函数，返回后由 Handle 关闭连接
 type handleRequest func(r *http.Request, writer *WSConn)
 
 type WSConn struct {
 	*WsHandler
 	conn *websocket.Conn
+	ctx  context.Context
+}
+
+// Context 在客户端断开连接后取消
+func (c *WSConn) Context() context.Context {
+	return c.ctx
 }
 
 func (c *WSConn) WriteJSON(msg any) error {
 	return writeJSON(c.conn, msg)
 }
 
-func (c *WSConn) Close() {
-	c.monitorMutex.Lock()
-	defer c.monitorMutex.Unlock()
-
-	closeConn(c.conn)
-	delete(c.monitorClients, c.conn)
+// WriteBinary 发送二进制消息
+func (c *WSConn) WriteBinary(data []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.BinaryMessage, data)
 }
 
 type WsHandler struct {
-	monitorClients map[*websocket.Conn]bool
+	monitorClients map[*websocket.Conn]*wsClient
 	monitorMutex   *sync.Mutex
 	handle         handleRequest
+	snapshot       SnapshotFunc
+	filter         FilterFunc
+	seq            int64
+	history        []WsMessage // 最近的事件，按序号递增
+}
+
+// wsClient 一个广播客户端，消息先进入有界队列，由独立的写协程发送，慢客户端不会阻塞广播
+type wsClient struct {
+	conn    *websocket.Conn
+	request *http.Request
+	since   int64
+
+	mu     sync.Mutex
+	queue  []WsMessage // 按 Seq 递增
+	resync bool        // 需要重新发送快照
+	filter WsFilter
+	notify chan struct{}
+	done   chan struct{}
+
+	lastSeq int64 // 只由写协程访问
 }
 
 func NewWsHandler(handle handleRequest) *WsHandler {
 	return &WsHandler{
-		monitorClients: make(map[*websocket.Conn]bool),
+		monitorClients: make(map[*websocket.Conn]*wsClient),
 		monitorMutex:   &sync.Mutex{},
 		handle:         handle,
 	}
 }
 
+// SetSnapshot 设置快照。客户端可以通过 ?seq= 提供最后收到的事件序号，
+// 事件仍在历史中时只补发缺失的事件，否则发送快照
+func (h *WsHandler) SetSnapshot(snapshot SnapshotFunc) {
+	h.monitorMutex.Lock()
+	defer h.monitorMutex.Unlock()
+	h.snapshot = snapshot
+}
+
+// SetFilter 允许客户端设置订阅条件：连接时通过 ?filter= 或之后发送 {"type": "filter", "filter": ...}，
+// 修改后重新发送符合新条件的快照
+func (h *WsHandler) SetFilter(filter FilterFunc) {
+	h.monitorMutex.Lock()
+	defer h.monitorMutex.Unlock()
+	h.filter = filter
+}
+
 func (h *WsHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Monitor WebSocket upgrade error:", err)
 		return
 	}
-	defer closeConn(conn)
-
-	h.monitorMutex.Lock()
-	h.monitorClients[conn] = true
-	h.monitorMutex.Unlock()
+	// 连接只由这里关闭，handle 返回和读取出错都会触发
+	closeOnce := sync.OnceFunc(func() { closeConn(conn) })
+	defer closeOnce()
 
 	log.Println("Monitor client connected to WebSocket")
+	defer log.Println("Monitor client disconnected")
 
-	// Cleanup when connection closes
-	defer func() {
-		h.monitorMutex.Lock()
-		delete(h.monitorClients, conn)
-		h.monitorMutex.Unlock()
-		log.Println("Monitor client disconnected")
-	}()
-
-	// 心跳ticker
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go keepAlive(conn, done)
 
 	if h.handle != nil {
-		go h.handle(r, &WSConn{h, conn})
+		// 由 handle 独占写入，不加入广播，客户端消息读取后丢弃
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			h.handle(r, &WSConn{h, conn, ctx})
+			// 关闭连接以结束下面的读取循环
+			closeOnce()
+		}()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				logReadError(err)
+				return
+			}
+		}
 	}
 
-	// 保持连接活跃状态
+	client := h.register(r, conn)
+	// Cleanup when connection closes
+	defer h.removeClient(conn)
+	go h.writeLoop(client)
+
+	// 保持连接活跃状态，处理客户端消息
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			logReadError(err)
+			return
+		}
+		h.handleClientMessage(client, data)
+	}
+}
+
+// keepAlive 心跳，WriteControl 可以与其他写操作并发调用
+func keepAlive(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
 				log.Printf("Monitor ping failed: %v", err)
+				_ = conn.Close()
 				return
 			}
-		default:
-			_, _, err := conn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("Monitor WebSocket connection closed unexpectedly: %v", err)
-				}
-				return
-			}
+		case <-done:
+			return
 		}
 	}
 }
 
-func (h *WsHandler) BoardCast(msg any) {
+func logReadError(err error) {
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		log.Printf("Monitor WebSocket connection closed unexpectedly: %v", err)
+	}
+}
+
+// handleClientMessage 处理客户端消息，目前只有修改订阅条件
+func (h *WsHandler) handleClientMessage(c *wsClient, data []byte) {
+	var msg wsClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.sendError(fmt.Sprintf("invalid message: %v", err))
+		return
+	}
+	if msg.Type != WsClientFilter {
+		c.sendError(fmt.Sprintf("unsupported message type: %s", msg.Type))
+		return
+	}
+
 	h.monitorMutex.Lock()
-	// 收集失败的客户端连接
-	var failedClients []*websocket.Conn
-	for client := range h.monitorClients {
-		err := writeJSON(client, msg)
+	defer h.monitorMutex.Unlock()
+
+	if h.filter == nil {
+		c.sendError("filters are not supported")
+		return
+	}
+	filter, err := h.filter(msg.Filter)
+	if err != nil {
+		c.sendError(fmt.Sprintf("invalid filter: %v", err))
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filter = filter
+	if h.snapshot != nil {
+		// 之前不匹配的请求也需要发送，快照包含所有匹配的请求
+		c.since = 0
+		c.queue = nil
+		c.resync = true
+		c.signal()
+	}
+}
+
+// sendError 将错误信息放入队列
+func (c *wsClient) sendError(msg string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queue = append(c.queue, WsMessage{Type: WsMessageError, Data: msg})
+	c.signal()
+}
+
+// register 加入广播：事件仍在历史中时排队补发，否则先发送快照
+func (h *WsHandler) register(r *http.Request, conn *websocket.Conn) *wsClient {
+	lastSeq, _ := strconv.ParseInt(r.URL.Query().Get("seq"), 10, 64)
+	since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	client := &wsClient{
+		conn:    conn,
+		request: r,
+		since:   since,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		lastSeq: lastSeq,
+	}
+
+	h.monitorMutex.Lock()
+	defer h.monitorMutex.Unlock()
+
+	if raw := r.URL.Query().Get("filter"); raw != "" && h.filter != nil {
+		filter, err := h.filter([]byte(raw))
 		if err != nil {
-			log.Printf("Monitor broadcast error: %v", err)
-			failedClients = append(failedClients, client)
+			client.queue = append(client.queue, WsMessage{Type: WsMessageError, Data: fmt.Sprintf("invalid filter: %v", err)})
 		}
+		client.filter = filter
 	}
-	// 清理失败的连接
-	for _, client := range failedClients {
-		_ = client.Close()
-		delete(h.monitorClients, client)
+
+	missed, ok := h.eventsAfter(lastSeq)
+	if ok {
+		for _, msg := range missed {
+			if client.filter == nil || client.filter.Match(msg.Data) {
+				client.queue = append(client.queue, msg)
+			}
+		}
+	} else if h.snapshot != nil {
+		client.resync = true
+	} else {
+		// 没有快照时无法补发的事件只能由客户端自行处理
+		client.lastSeq = h.seq
 	}
+	h.monitorClients[conn] = client
+	client.signal()
+	return client
+}
+
+func (h *WsHandler) removeClient(conn *websocket.Conn) {
+	h.monitorMutex.Lock()
+	client, ok := h.monitorClients[conn]
+	delete(h.monitorClients, conn)
 	h.monitorMutex.Unlock()
+
+	if ok {
+		close(client.done)
+	}
+}
+
+// eventsAfter 返回序号大于 seq 的历史事件，历史中已没有这些事件时返回 false，需要持有 monitorMutex
+func (h *WsHandler) eventsAfter(seq int64) ([]WsMessage, bool) {
+	if seq <= 0 || seq > h.seq {
+		return nil, false
+	}
+	if seq == h.seq {
+		return nil, true
+	}
+	if len(h.history) == 0 || h.history[0].Seq > seq+1 {
+		return nil, false
+	}
+	return h.history[seq+1-h.history[0].Seq:], true
+}
+
+// BoardCast 为消息分配序号并放入所有客户端的队列，不会等待发送
+func (h *WsHandler) BoardCast(data any) {
+	h.monitorMutex.Lock()
+	defer h.monitorMutex.Unlock()
+
+	h.seq++
+	msg := WsMessage{Type: WsMessageEvent, Seq: h.seq, Data: data}
+	h.history = append(h.history, msg)
+	if len(h.history) > wsHistorySize {
+		h.history = append([]WsMessage(nil), h.history[len(h.history)-wsHistorySize/2:]...)
+	}
+
+	for _, client := range h.monitorClients {
+		client.enqueue(msg, h.snapshot != nil)
+	}
+}
+
+// enqueue 加入队列并合并同一对象的旧消息；队列已满时改为重新发送快照，没有快照时丢弃最旧的消息
+func (c *wsClient) enqueue(msg WsMessage, canResync bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resync || (c.filter != nil && !c.filter.Match(msg.Data)) {
+		return
+	}
+	if coalescer, ok := msg.Data.(Coalescer); ok {
+		key := coalescer.CoalesceKey()
+		for i, queued := range c.queue {
+			if queued, ok := queued.Data.(Coalescer); ok && queued.CoalesceKey() == key {
+				// 移到队尾，保证队列按 Seq 递增，断线续传时不会漏掉事件
+				c.queue = append(c.queue[:i], c.queue[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if len(c.queue) >= wsQueueSize {
+		if canResync {
+			log.Printf("Monitor client %s fell behind, resending snapshot", c.conn.RemoteAddr())
+			c.queue = nil
+			c.resync = true
+			c.signal()
+			return
+		}
+		c.queue = c.queue[1:]
+	}
+	c.queue = append(c.queue, msg)
+	c.signal()
+}
+
+func (c *wsClient) signal() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop 写协程，依次发送队列中的消息，需要时先发送快照
+func (h *WsHandler) writeLoop(c *wsClient) {
+	for {
+		select {
+		case <-c.notify:
+		case <-c.done:
+			return
+		}
+
+		for {
+			msg, ok := h.nextMessage(c)
+			if !ok {
+				break
+			}
+			switch msg.Type {
+			case WsMessageEvent:
+				// 快照之前排队的旧事件已经包含在快照中
+				if msg.Seq <= c.lastSeq {
+					continue
+				}
+			case WsMessageSnapshot:
+				req := msg.Data.(snapshotRequest)
+				msg.Data = h.snapshot(c.request, req.since, req.filter)
+			case WsMessageError:
+				// 不是事件，不影响序号
+				msg.Seq = c.lastSeq
+			}
+
+			msg.Prev = c.lastSeq
+			if err := writeJSON(c.conn, msg); err != nil {
+				log.Printf("Monitor broadcast error: %v", err)
+				_ = c.conn.Close()
+				return
+			}
+			c.lastSeq = msg.Seq
+		}
+	}
+}
+
+// snapshotRequest 快照占位消息的 Data，记录生成快照时使用的参数
+type snapshotRequest struct {
+	since  int64
+	filter WsFilter
+}
+
+// nextMessage 取出下一条待发送的消息。需要重新发送快照时清空队列并返回快照占位消息，
+// 快照的 Seq 与清空队列在同一把锁内确定，之后的事件都在快照之后
+func (h *WsHandler) nextMessage(c *wsClient) (WsMessage, bool) {
+	h.monitorMutex.Lock()
+	defer h.monitorMutex.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resync {
+		c.resync = false
+		// 快照之后的事件会重新排队，错误信息仍需发送
+		c.queue = slices.DeleteFunc(c.queue, func(msg WsMessage) bool { return msg.Type == WsMessageEvent })
+		return WsMessage{Type: WsMessageSnapshot, Seq: h.seq, Data: snapshotRequest{c.since, c.filter}}, true
+	}
+	if len(c.queue) == 0 {
+		return WsMessage{}, false
+	}
+	msg := c.queue[0]
+	c.queue = c.queue[1:]
+	return msg, true
 }
 
 func writeJSON(client *websocket.Conn, msg any) error {
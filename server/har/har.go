@@ -0,0 +1,342 @@
+// Package har 在抓包记录和 HAR 1.2（HTTP Archive）之间转换
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"proxyMan/server/common"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	Version        = "1.2"
+	CreatorName    = "proxyMan"
+	CreatorVersion = "1.0.0"
+
+	// startedDateTime 使用的 ISO 8601 格式
+	timeFormat = "2006-01-02T15:04:05.000Z07:00"
+)
+
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry 一个请求，以 _ 开头的字段为 proxyMan 的扩展字段，导入时用于恢复抓包记录
+type Entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"` // 毫秒
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"`
+	Comment         string   `json:"comment,omitempty"`
+
+	ID       int64           `json:"_id,omitempty"`
+	Listener string          `json:"_listener,omitempty"`
+	Tags     []string        `json:"_tags,omitempty"`
+	Error    string          `json:"_error,omitempty"`
+	TLS      *common.TLSInfo `json:"_tls,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// PostData 请求 body，HAR 1.2 没有定义二进制编码，二进制 body 使用 base64 并标记 encoding（与 Content 一致）
+type PostData struct {
+	MimeType string      `json:"mimeType"`
+	Params   []NameValue `json:"params,omitempty"`
+	Text     string      `json:"text"`
+	Encoding string      `json:"encoding,omitempty"`
+}
+
+type Content struct {
+	Size        int    `json:"size"`
+	Compression int    `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"` // base64 或空（文本）
+}
+
+// Timings 各阶段耗时（毫秒），-1 表示不适用。proxyMan 不记录连接建立的耗时，计入 send
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// New 将抓包记录转换为 HAR
+func New(contents []*common.HttpContents) *HAR {
+	entries := make([]Entry, 0, len(contents))
+	for _, c := range contents {
+		entries = append(entries, NewEntry(c))
+	}
+	return &HAR{Log: Log{
+		Version: Version,
+		Creator: Creator{Name: CreatorName, Version: CreatorVersion},
+		Entries: entries,
+	}}
+}
+
+// Writer 逐个写入 entry，导出大量请求时不需要同时保存所有 body
+type Writer struct {
+	w     io.Writer
+	count int
+	err   error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) Write(entry Entry) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.count == 0 {
+		creator, _ := json.Marshal(Creator{Name: CreatorName, Version: CreatorVersion})
+		_, w.err = io.WriteString(w.w, `{"log":{"version":"`+Version+`","creator":`+string(creator)+`,"entries":[`)
+	} else {
+		_, w.err = io.WriteString(w.w, ",")
+	}
+	if w.err == nil {
+		var data []byte
+		if data, w.err = json.Marshal(entry); w.err == nil {
+			_, w.err = w.w.Write(data)
+		}
+	}
+	w.count++
+	return w.err
+}
+
+// Close 结束 HAR，没有写入任何 entry 时输出空的 entries
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.count == 0 {
+		return json.NewEncoder(w.w).Encode(New(nil))
+	}
+	_, w.err = io.WriteString(w.w, "]}}\n")
+	return w.err
+}
+
+// NewEntry 将一个请求转换为 HAR entry
+func NewEntry(c *common.HttpContents) Entry {
+	var started time.Time
+	if c.StartTime != nil {
+		started = *c.StartTime
+	}
+	var total float64
+	if c.StartTime != nil && c.EndTime != nil {
+		total = milliseconds(c.EndTime.Sub(*c.StartTime))
+	}
+
+	return Entry{
+		StartedDateTime: started.Format(timeFormat),
+		Time:            total,
+		Request:         newRequest(c),
+		Response:        newResponse(c),
+		Timings:         newTimings(c, total),
+		Comment:         c.Notes,
+		ID:              c.ID,
+		Listener:        c.Listener,
+		Tags:            c.Tags,
+		Error:           c.Error,
+		TLS:             c.TLS,
+	}
+}
+
+// newTimings 按请求发送完成和收到响应头的时间划分 send、wait、receive，没有记录时全部计入 wait
+func newTimings(c *common.HttpContents, total float64) Timings {
+	timings := Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: total}
+	if c.StartTime == nil || c.EndTime == nil || c.Timing.ResponseStart == nil {
+		return timings
+	}
+
+	start, responseStart, end := *c.StartTime, *c.Timing.ResponseStart, *c.EndTime
+	// 服务端可能在读完请求 body 之前响应
+	sent := start
+	if c.Timing.RequestSent != nil && c.Timing.RequestSent.Before(responseStart) {
+		sent = *c.Timing.RequestSent
+	}
+	timings.Send = milliseconds(sent.Sub(start))
+	timings.Wait = milliseconds(responseStart.Sub(sent))
+	timings.Receive = milliseconds(end.Sub(responseStart))
+	return timings
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(max(d, 0).Microseconds()) / 1000
+}
+
+func newRequest(c *common.HttpContents) Request {
+	req := Request{
+		Method:      c.Method,
+		URL:         c.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     requestCookies(c.RequestHeaders),
+		Headers:     nameValues(c.RequestHeaders),
+		QueryString: []NameValue{},
+		HeadersSize: -1,
+		BodySize:    len(c.RequestBody),
+	}
+
+	if u, err := url.Parse(c.URL); err == nil {
+		req.QueryString = queryValues(u.Query())
+	}
+
+	if len(c.RequestBody) > 0 {
+		mimeType := c.RequestHeaders.Get("Content-Type")
+		text, encoding := encodeText(c.RequestBody)
+		req.PostData = &PostData{MimeType: mimeType, Text: text, Encoding: encoding}
+		if strings.HasPrefix(mimeType, "application/x-www-form-urlencoded") {
+			if values, err := url.ParseQuery(string(c.RequestBody)); err == nil {
+				req.PostData.Params = queryValues(values)
+			}
+		}
+	}
+	return req
+}
+
+func newResponse(c *common.HttpContents) Response {
+	text, encoding := encodeText(c.ResponseBody)
+	resp := Response{
+		Status:      c.StatusCode,
+		StatusText:  http.StatusText(c.StatusCode),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     responseCookies(c.ResponseHeaders),
+		Headers:     nameValues(c.ResponseHeaders),
+		Content: Content{
+			Size:     len(c.ResponseBody),
+			MimeType: c.ContentType,
+			Text:     text,
+			Encoding: encoding,
+		},
+		RedirectURL: c.ResponseHeaders.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(c.ResponseBody),
+	}
+	if c.StatusCode == 0 {
+		// 没有收到响应（请求出错或未结束）
+		resp.HTTPVersion = ""
+		resp.BodySize = -1
+	}
+	return resp
+}
+
+// encodeText 文本原样输出，二进制使用 base64
+func encodeText(data []byte) (text, encoding string) {
+	if len(data) == 0 {
+		return "", ""
+	}
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+// nameValues 按名称排序输出 header，同名的多个值分别输出
+func nameValues(header http.Header) []NameValue {
+	result := []NameValue{}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			result = append(result, NameValue{Name: name, Value: value})
+		}
+	}
+	return result
+}
+
+func queryValues(values url.Values) []NameValue {
+	return nameValues(http.Header(values))
+}
+
+func requestCookies(header http.Header) []Cookie {
+	result := []Cookie{}
+	for _, cookie := range (&http.Request{Header: header}).Cookies() {
+		result = append(result, Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return result
+}
+
+func responseCookies(header http.Header) []Cookie {
+	result := []Cookie{}
+	for _, cookie := range (&http.Response{Header: header}).Cookies() {
+		c := Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			c.Expires = cookie.Expires.Format(timeFormat)
+		}
+		result = append(result, c)
+	}
+	return result
+}
@@ -0,0 +1,214 @@
+package har
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"proxyMan/server/common"
+	"strings"
+	"time"
+)
+
+// Decoder 逐个读取 HAR 文件中的 entry，不需要把整个文件读入内存
+type Decoder struct {
+	dec       *json.Decoder
+	inEntries bool
+	done      bool
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// Next 返回下一个 entry，没有更多 entry 时返回 io.EOF。log.entries 之后的内容不再读取
+func (d *Decoder) Next() (Entry, error) {
+	var entry Entry
+	if d.done {
+		return entry, io.EOF
+	}
+	if !d.inEntries {
+		if err := d.findEntries(); err != nil {
+			d.done = true
+			return entry, err
+		}
+		d.inEntries = true
+	}
+	if !d.dec.More() {
+		d.done = true
+		return entry, io.EOF
+	}
+	if err := d.dec.Decode(&entry); err != nil {
+		d.done = true
+		return entry, fmt.Errorf("invalid HAR entry: %w", err)
+	}
+	return entry, nil
+}
+
+// findEntries 定位到 log.entries 数组的开头，没有 entries 时返回 io.EOF
+func (d *Decoder) findEntries() error {
+	if err := d.enterObject(); err != nil {
+		return err
+	}
+	if found, err := d.findKey("log"); err != nil {
+		return err
+	} else if !found {
+		return fmt.Errorf("invalid HAR: missing log")
+	}
+	if err := d.enterObject(); err != nil {
+		return err
+	}
+	if found, err := d.findKey("entries"); err != nil || !found {
+		return cmp.Or(err, io.EOF)
+	}
+	if token, err := d.dec.Token(); err != nil {
+		return fmt.Errorf("invalid HAR: %w", err)
+	} else if token != json.Delim('[') {
+		return fmt.Errorf("invalid HAR: entries is not an array")
+	}
+	return nil
+}
+
+func (d *Decoder) enterObject() error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return fmt.Errorf("invalid HAR: %w", err)
+	}
+	if token != json.Delim('{') {
+		return fmt.Errorf("invalid HAR: expected an object")
+	}
+	return nil
+}
+
+// findKey 在当前对象中跳过其他字段，直到找到 key，之后读取的是该字段的值
+func (d *Decoder) findKey(key string) (bool, error) {
+	for d.dec.More() {
+		token, err := d.dec.Token()
+		if err != nil {
+			return false, fmt.Errorf("invalid HAR: %w", err)
+		}
+		if token == key {
+			return true, nil
+		}
+		var skipped json.RawMessage
+		if err := d.dec.Decode(&skipped); err != nil {
+			return false, fmt.Errorf("invalid HAR: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// Contents 将 HAR entry 转换为请求记录，ID 由调用方分配
+func (e Entry) Contents() (*common.HttpContents, error) {
+	started, err := parseTime(e.StartedDateTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid startedDateTime %q: %w", e.StartedDateTime, err)
+	}
+	ended := started.Add(time.Duration(e.Time * float64(time.Millisecond)))
+
+	requestBody, err := e.Request.PostData.body()
+	if err != nil {
+		return nil, fmt.Errorf("invalid postData of %s: %w", e.Request.URL, err)
+	}
+	responseBody, err := decodeText(e.Response.Content.Text, e.Response.Content.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response content of %s: %w", e.Request.URL, err)
+	}
+
+	c := &common.HttpContents{
+		RequestSummary: common.RequestSummary{
+			StartTime:   &started,
+			EndTime:     &ended,
+			Status:      common.StatusCompleted,
+			Listener:    e.Listener,
+			Method:      e.Request.Method,
+			URL:         e.Request.URL,
+			ContentType: e.Response.Content.MimeType,
+			StatusCode:  e.Response.Status,
+			Tags:        e.Tags,
+		},
+		RequestHeaders:  header(e.Request.Headers),
+		RequestBody:     requestBody,
+		ResponseHeaders: header(e.Response.Headers),
+		ResponseBody:    responseBody,
+		Error:           e.Error,
+		Timing:          e.Timings.timing(started),
+		TLS:             e.TLS,
+		Notes:           e.Comment,
+	}
+	if u, err := url.Parse(e.Request.URL); err == nil {
+		c.Host = u.Host
+	}
+	if c.ContentType == "" {
+		c.ContentType = c.ResponseHeaders.Get("Content-Type")
+	}
+	if c.Error == "" && c.StatusCode == 0 {
+		// 浏览器导出的 HAR 中被取消或失败的请求没有响应
+		c.Error = "no response"
+	}
+	if c.Error != "" {
+		c.Status = common.StatusError
+	}
+	return c, nil
+}
+
+// timing 按各阶段耗时还原请求发送完成和收到响应头的时间，没有 wait 时返回零值
+func (t Timings) timing(started time.Time) common.Timing {
+	if t.Wait < 0 || (t.Wait == 0 && t.Send == 0 && t.Receive == 0) {
+		return common.Timing{}
+	}
+	var before float64
+	for _, phase := range []float64{t.Blocked, t.DNS, t.Connect, t.Send} {
+		before += max(phase, 0)
+	}
+	sent := started.Add(time.Duration(before * float64(time.Millisecond)))
+	responseStart := sent.Add(time.Duration(t.Wait * float64(time.Millisecond)))
+	return common.Timing{RequestSent: &sent, ResponseStart: &responseStart}
+}
+
+// body 返回请求 body，只有 params 时按表单编码
+func (p *PostData) body() ([]byte, error) {
+	if p == nil {
+		return nil, nil
+	}
+	if p.Text == "" && len(p.Params) > 0 {
+		values := url.Values{}
+		for _, param := range p.Params {
+			values.Add(param.Name, param.Value)
+		}
+		return []byte(values.Encode()), nil
+	}
+	return decodeText(p.Text, p.Encoding)
+}
+
+func decodeText(text, encoding string) ([]byte, error) {
+	if text == "" {
+		return nil, nil
+	}
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+// header 转换 header，忽略 HTTP/2 的伪首部（:authority 等）
+func header(values []NameValue) http.Header {
+	h := http.Header{}
+	for _, v := range values {
+		if strings.HasPrefix(v.Name, ":") {
+			continue
+		}
+		h.Add(v.Name, v.Value)
+	}
+	return h
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"proxyMan/server/common"
 	"proxyMan/server/web"
 
 	"github.com/wailsapp/wails/v2"
@@ -19,7 +20,7 @@ import (
 
 // Run 启动 Wails 桌面应用模式
 func Run(assets *embed.FS) {
-	// 启用 CORS（桌面应用需要）
+	// 启用 CORS（桌面应用需要），只允许 Wails WebView 的 Origin
 	web.EnableCORS = true
 	log.Println("Running in Wails desktop mode, CORS enabled")
 
@@ -77,6 +78,16 @@ func (a *App) GetServerPort() int {
 	return web.ServerPort
 }
 
+// GetServerScheme 返回 Web 服务器使用的协议（http 或 https）
+func (a *App) GetServerScheme() string {
+	return web.ServerScheme()
+}
+
+// GetApiToken 返回 Web API 令牌，桌面端前端自动携带
+func (a *App) GetApiToken() string {
+	return common.GetConfig().APIToken
+}
+
 // startup 在应用启动时调用
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
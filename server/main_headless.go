@@ -4,12 +4,24 @@ package server
 
 import (
 	"embed"
+	"fmt"
 	"log"
+	"net"
+	"proxyMan/server/common"
 	"proxyMan/server/web"
+	"strconv"
 )
 
 // Run 在非桌面模式下不执行任何操作
 func Run(assets *embed.FS) {
-	log.Printf("web ui mode actived! plaese visit http://127.0.0.1:%d", web.ServerPort)
+	host := web.ServerHost
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	addr := web.ServerScheme() + "://" + net.JoinHostPort(host, strconv.Itoa(web.ServerPort))
+	// 日志会写入文件，只记录不带令牌的地址
+	log.Printf("web ui mode actived! plaese visit %s/", addr)
+	// 首次访问时前端从 URL 中读取令牌并保存，带令牌的地址只输出到终端
+	fmt.Printf("web ui: %s/?token=%s\n", addr, common.GetConfig().APIToken)
 	select {} // 永久阻塞
 }
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"proxyMan/server/common"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRejectedAttempts = 200
+
+// RejectedAttempt 一次被拒绝的代理访问
+type RejectedAttempt struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	Listener string    `json:"listener"`
+	Reason   string    `json:"reason"`
+	Target   string    `json:"target,omitempty"`
+}
+
+var (
+	accessConfig     common.AccessConfig
+	allowedNets      []*net.IPNet
+	accessConfigLock sync.RWMutex
+
+	rejectedAttempts     []RejectedAttempt
+	rejectedAttemptsLock sync.Mutex
+)
+
+func init() {
+	cfg := common.GetConfig().Access
+	nets, err := parseCIDRs(cfg.AllowedCIDRs)
+	if err != nil {
+		log.Printf("Invalid allowed client list, access control disabled: %v", err)
+		cfg.AllowedCIDRs = nil
+	}
+	accessConfig = cfg
+	allowedNets = nets
+}
+
+func GetAccessConfig() common.AccessConfig {
+	accessConfigLock.RLock()
+	defer accessConfigLock.RUnlock()
+	return accessConfig
+}
+
+// SetAccessConfig 校验并持久化访问控制配置，立即对新连接生效
+func SetAccessConfig(cfg common.AccessConfig) error {
+	if cfg.AuthEnabled && cfg.Username == "" {
+		return fmt.Errorf("username is required when proxy auth is enabled")
+	}
+	nets, err := parseCIDRs(cfg.AllowedCIDRs)
+	if err != nil {
+		return err
+	}
+
+	accessConfigLock.Lock()
+	defer accessConfigLock.Unlock()
+
+	if err := common.UpdateAccessConfig(cfg); err != nil {
+		return err
+	}
+	accessConfig = cfg
+	allowedNets = nets
+	return nil
+}
+
+// parseCIDRs 解析网段列表，单个 IP 视为 /32 或 /128
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// clientAllowed 判断客户端地址是否在允许的网段内
+func clientAllowed(addr net.Addr) bool {
+	accessConfigLock.RLock()
+	defer accessConfigLock.RUnlock()
+
+	if len(allowedNets) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ipNet := range allowedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyAuthRequired 是否开启了代理认证
+func proxyAuthRequired() bool {
+	accessConfigLock.RLock()
+	defer accessConfigLock.RUnlock()
+	return accessConfig.AuthEnabled
+}
+
+// checkCredentials 校验代理用户名和密码
+func checkCredentials(username, password string) bool {
+	accessConfigLock.RLock()
+	defer accessConfigLock.RUnlock()
+
+	userOk := subtle.ConstantTimeCompare([]byte(username), []byte(accessConfig.Username)) == 1
+	passOk := subtle.ConstantTimeCompare([]byte(password), []byte(accessConfig.Password)) == 1
+	return userOk && passOk
+}
+
+// checkProxyAuthorization 校验 Proxy-Authorization 头，返回拒绝原因，通过时返回空字符串
+func checkProxyAuthorization(header string) string {
+	if !proxyAuthRequired() {
+		return ""
+	}
+	if header == "" {
+		return "missing credentials"
+	}
+	scheme, encoded, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "unsupported auth scheme"
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "malformed credentials"
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok || !checkCredentials(username, password) {
+		return "invalid credentials"
+	}
+	return ""
+}
+
+// writeProxyAuthRequired 返回 407 质询
+func writeProxyAuthRequired(w http.ResponseWriter) {
+	w.Header().Set("Proxy-Authenticate", `Basic realm="ProxyMan"`)
+	http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+}
+
+// recordRejected 记录被拒绝的访问
+func recordRejected(client, listener, reason, target string) {
+	attempt := RejectedAttempt{
+		Time:     time.Now(),
+		Client:   client,
+		Listener: listener,
+		Reason:   reason,
+		Target:   target,
+	}
+	log.Printf("Rejected proxy access from %s on %s: %s %s", attempt.Client, listener, reason, target)
+
+	rejectedAttemptsLock.Lock()
+	defer rejectedAttemptsLock.Unlock()
+	if len(rejectedAttempts) >= maxRejectedAttempts {
+		rejectedAttempts = rejectedAttempts[1:]
+	}
+	rejectedAttempts = append(rejectedAttempts, attempt)
+}
+
+// GetRejectedAttempts 返回最近被拒绝的访问，最新的在前
+func GetRejectedAttempts() []RejectedAttempt {
+	rejectedAttemptsLock.Lock()
+	defer rejectedAttemptsLock.Unlock()
+
+	result := make([]RejectedAttempt, 0, len(rejectedAttempts))
+	for i := len(rejectedAttempts) - 1; i >= 0; i-- {
+		result = append(result, rejectedAttempts[i])
+	}
+	return result
+}
+
+// accessListener 直接关闭不在允许网段内的客户端连接
+type accessListener struct {
+	net.Listener
+	name string
+}
+
+func (l accessListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if clientAllowed(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		recordRejected(conn.RemoteAddr().String(), l.name, "client not allowed", "")
+		_ = conn.Close()
+	}
+}
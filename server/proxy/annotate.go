@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"fmt"
+	"proxyMan/server/common"
+	"slices"
+	"strings"
+)
+
+// SetTags 替换请求的标签
+func SetTags(id int64, tags []string) error {
+	return annotate(id, func(c *common.HttpContents) {
+		c.Tags = normalizeTags(tags)
+	})
+}
+
+// SetNotes 替换请求的备注
+func SetNotes(id int64, notes string) error {
+	return annotate(id, func(c *common.HttpContents) {
+		c.Notes = notes
+	})
+}
+
+// annotate 修改请求的标签、备注等用户数据，已结束的请求会重新保存到持久化存储。
+// 已被淘汰的请求会从持久化存储中重新加载
+func annotate(id int64, update func(c *common.HttpContents)) error {
+	p := getFromCache(id)
+	if p == nil {
+		if p = loadProxy(id); p == nil {
+			return fmt.Errorf("request %d not found", id)
+		}
+		addToCache(p, true)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	update(p.Contents)
+	if p.Contents.Status == common.StatusCompleted || p.Contents.Status == common.StatusError {
+		p.persist()
+	}
+	common.ReqSummary.BoardCast(p.Contents.RequestSummary)
+	return nil
+}
+
+// normalizeTags 去掉空白和重复的标签
+func normalizeTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// hasTag 判断标签列表是否包含 tag，不区分大小写
+func hasTag(tags []string, tag string) bool {
+	return slices.ContainsFunc(tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
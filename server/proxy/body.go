@@ -0,0 +1,322 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"proxyMan/server/common"
+	"sync"
+	"sync/atomic"
+)
+
+// BodyStats body 缓存的使用情况
+type BodyStats struct {
+	MemoryBytes   int64 `json:"memoryBytes"`   // 所有 body 当前占用的内存，包括预览
+	MemoryBudget  int64 `json:"memoryBudget"`  // 内存上限
+	SpilledBodies int64 `json:"spilledBodies"` // 写入临时文件的 body 数量
+	SpilledBytes  int64 `json:"spilledBytes"`
+}
+
+var (
+	bodyConfig     common.BodyConfig
+	bodyConfigLock sync.RWMutex
+
+	bodyMemory    atomic.Int64
+	spilledBodies atomic.Int64
+	spilledBytes  atomic.Int64
+)
+
+func init() {
+	bodyConfig = common.GetConfig().Body
+}
+
+func GetBodyConfig() common.BodyConfig {
+	bodyConfigLock.RLock()
+	defer bodyConfigLock.RUnlock()
+	return bodyConfig
+}
+
+// SetBodyConfig 校验并持久化 body 缓存配置，对之后写入的数据生效
+func SetBodyConfig(cfg common.BodyConfig) error {
+	if cfg.SpillThresholdKB < 0 || cfg.PreviewKB < 0 || cfg.MemoryBudgetMB < 0 || cfg.MaxBodyMB < 0 {
+		return fmt.Errorf("body limits must not be negative")
+	}
+	if err := os.MkdirAll(cfg.SpillDirPath(), 0700); err != nil {
+		return fmt.Errorf("failed to create spill dir: %w", err)
+	}
+
+	bodyConfigLock.Lock()
+	bodyConfig = cfg
+	bodyConfigLock.Unlock()
+
+	return common.UpdateBodyConfig(cfg)
+}
+
+func GetBodyStats() BodyStats {
+	return BodyStats{
+		MemoryBytes:   bodyMemory.Load(),
+		MemoryBudget:  int64(GetBodyConfig().MemoryBudgetMB) * 1024 * 1024,
+		SpilledBodies: spilledBodies.Load(),
+		SpilledBytes:  spilledBytes.Load(),
+	}
+}
+
+// reserveMemory 在内存上限内占用 n 字节，超出时返回 false
+func reserveMemory(n, budget int64) bool {
+	if bodyMemory.Add(n) > budget {
+		bodyMemory.Add(-n)
+		return false
+	}
+	return true
+}
+
+// bodyBuffer 记录请求或响应 body。
+// 数据先保存在内存中，超过单个 body 阈值或全局内存上限后整体写入临时文件，内存中只保留头尾预览。
+// 所有方法都需要持有所属 DataProxy 的锁。
+type bodyBuffer struct {
+	chunks    [][]byte // 写入文件之前的数据
+	file      *spillFile
+	size      int64 // 已记录的大小
+	head      []byte
+	tail      []byte
+	memory    int64 // 计入 bodyMemory 的大小
+	truncated bool
+	ended     bool // body 已结束或请求出错，不会再有新数据
+	released  bool // 已移出内存缓存，数据已释放
+}
+
+// bodyView 某一时刻已记录数据的只读视图，可以在不持有锁时读取。
+// 内存中的分段写入后不再修改；文件需要由使用者持有引用
+type bodyView struct {
+	file   *spillFile
+	chunks [][]byte
+	size   int64
+}
+
+// spillFile 带引用计数的临时文件，释放时仍在被读取的文件在读取结束后关闭
+type spillFile struct {
+	*os.File
+	refs atomic.Int32
+	// 创建后无法立即删除的临时文件（Windows 不能删除已打开的文件），关闭时删除
+	removeOnClose string
+}
+
+func (f *spillFile) acquire() {
+	f.refs.Add(1)
+}
+
+func (f *spillFile) close() {
+	if f.refs.Add(-1) > 0 {
+		return
+	}
+	_ = f.File.Close()
+	if f.removeOnClose != "" {
+		_ = os.Remove(f.removeOnClose)
+	}
+}
+
+// write 追加数据，超过单个 body 上限的部分被丢弃
+func (b *bodyBuffer) write(chunk []byte) {
+	if b.truncated {
+		return
+	}
+
+	cfg := GetBodyConfig()
+	if limit := int64(cfg.MaxBodyMB) * 1024 * 1024; limit > 0 && b.size+int64(len(chunk)) > limit {
+		// 上限可能在记录过程中调低，已记录的部分可能已经超过上限
+		chunk = chunk[:max(limit-b.size, 0)]
+		b.truncated = true
+	}
+	if len(chunk) == 0 {
+		return
+	}
+
+	n := int64(len(chunk))
+	if b.file == nil {
+		threshold := int64(cfg.SpillThresholdKB) * 1024
+		budget := int64(cfg.MemoryBudgetMB) * 1024 * 1024
+		if b.size+n <= threshold && reserveMemory(n, budget) {
+			chunkCopy := make([]byte, len(chunk))
+			copy(chunkCopy, chunk)
+			b.chunks = append(b.chunks, chunkCopy)
+			b.memory += n
+			b.size += n
+			return
+		}
+		if err := b.spill(cfg); err != nil {
+			log.Printf("Failed to spill body to disk, dropping the rest: %v", err)
+			b.truncated = true
+			return
+		}
+	}
+
+	if _, err := b.file.WriteAt(chunk, b.size); err != nil {
+		log.Printf("Failed to write body to %s, dropping the rest: %v", b.file.Name(), err)
+		b.truncated = true
+		return
+	}
+	b.size += n
+	spilledBytes.Add(n)
+	b.updatePreview(chunk, cfg.PreviewKB*1024)
+}
+
+// spill 将内存中的数据写入临时文件
+func (b *bodyBuffer) spill(cfg common.BodyConfig) error {
+	dir := cfg.SpillDirPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "body-*")
+	if err != nil {
+		return err
+	}
+	file := &spillFile{File: f}
+	file.acquire()
+	// 打开后立即删除，进程退出时不会遗留临时文件
+	if err := os.Remove(f.Name()); err != nil {
+		file.removeOnClose = f.Name()
+	}
+
+	var offset int64
+	for _, chunk := range b.chunks {
+		if _, err := file.WriteAt(chunk, offset); err != nil {
+			file.close()
+			return err
+		}
+		offset += int64(len(chunk))
+		b.updatePreview(chunk, cfg.PreviewKB*1024)
+	}
+
+	bodyMemory.Add(-offset)
+	b.memory -= offset
+	b.chunks = nil
+	b.file = file
+	spilledBodies.Add(1)
+	spilledBytes.Add(offset)
+	return nil
+}
+
+// updatePreview 更新头部和尾部预览
+func (b *bodyBuffer) updatePreview(chunk []byte, previewSize int) {
+	before := len(b.head) + len(b.tail)
+
+	if len(b.head) < previewSize {
+		n := min(previewSize-len(b.head), len(chunk))
+		b.head = append(b.head, chunk[:n]...)
+	}
+	b.tail = append(b.tail, chunk...)
+	if len(b.tail) > previewSize {
+		b.tail = append([]byte(nil), b.tail[len(b.tail)-previewSize:]...)
+	}
+
+	delta := int64(len(b.head) + len(b.tail) - before)
+	bodyMemory.Add(delta)
+	b.memory += delta
+}
+
+// view 返回当前已记录数据的视图，不增加文件引用
+func (b *bodyBuffer) view() bodyView {
+	return bodyView{file: b.file, chunks: b.chunks, size: b.size}
+}
+
+// readAt 从 offset 处读取视图中的数据，没有更多数据时返回 0
+func (v bodyView) readAt(p []byte, offset int64) (int, error) {
+	if offset >= v.size {
+		return 0, nil
+	}
+
+	if v.file != nil {
+		n, err := v.file.ReadAt(p[:min(int64(len(p)), v.size-offset)], offset)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	}
+
+	for _, chunk := range v.chunks {
+		if offset < int64(len(chunk)) {
+			return copy(p, chunk[offset:]), nil
+		}
+		offset -= int64(len(chunk))
+	}
+	return 0, nil
+}
+
+// finish body 结束时合并内存中的数据并返回，已写入文件时返回 nil
+func (b *bodyBuffer) finish() []byte {
+	b.ended = true
+	if b.file != nil {
+		return nil
+	}
+	data := b.join()
+	if data != nil {
+		b.chunks = [][]byte{data}
+	}
+	return data
+}
+
+func (b *bodyBuffer) join() []byte {
+	if b.size == 0 {
+		return nil
+	}
+	if len(b.chunks) == 1 {
+		return b.chunks[0]
+	}
+	data := make([]byte, 0, b.size)
+	for _, chunk := range b.chunks {
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+// snapshot 返回读取当前已记录数据的函数，返回的函数必须调用一次：
+// 内存中的数据立即复制，文件中的数据在调用时读取，读取失败时返回预览
+func (b *bodyBuffer) snapshot() func() []byte {
+	if b.file == nil {
+		data := b.join()
+		return func() []byte { return data }
+	}
+
+	file, size, preview := b.file, b.size, b.preview()
+	file.acquire()
+	return func() []byte {
+		defer file.close()
+		data := make([]byte, size)
+		if _, err := file.ReadAt(data, 0); err != nil && err != io.EOF {
+			log.Printf("Failed to read spilled body, using preview: %v", err)
+			return preview
+		}
+		return data
+	}
+}
+
+// preview 返回头尾预览，两者重叠时拼接为完整数据
+func (b *bodyBuffer) preview() []byte {
+	if b.size <= int64(len(b.head)) {
+		return append([]byte(nil), b.head...)
+	}
+	data := append([]byte(nil), b.head...)
+	if rest := b.size - int64(len(b.head)); rest <= int64(len(b.tail)) {
+		return append(data, b.tail[int64(len(b.tail))-rest:]...)
+	}
+	return append(data, b.tail...)
+}
+
+// release 释放内存和临时文件，请求被移出内存缓存时调用
+func (b *bodyBuffer) release() {
+	bodyMemory.Add(-b.memory)
+	b.memory = 0
+	b.chunks = nil
+	b.head = nil
+	b.tail = nil
+
+	if b.file != nil {
+		spilledBodies.Add(-1)
+		spilledBytes.Add(-b.size)
+		b.file.close()
+		b.file = nil
+	}
+	b.size = 0
+	b.released = true
+}
@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"container/list"
+	"fmt"
+	"proxyMan/server/common"
+	"sync"
+)
+
+// CacheStats 内存中请求记录的使用情况
+type CacheStats struct {
+	Count    int   `json:"count"`
+	Bytes    int64 `json:"bytes"` // 请求和响应 body 的总大小，包括写入临时文件的部分
+	Pinned   int   `json:"pinned"`
+	Inflight int   `json:"inflight"` // 未结束的请求，不会被淘汰
+}
+
+// cacheEntry 缓存中的一条请求记录，字段由 cacheMutex 保护
+type cacheEntry struct {
+	proxy    *DataProxy
+	size     int64
+	pinned   bool
+	finished bool
+}
+
+// 内存中的请求记录，cacheOrder 从新到旧排列，淘汰时从尾部开始。
+// 锁顺序：可以在持有 DataProxy 的锁时获取 cacheMutex，反之不行；被淘汰请求的 release 必须在不持有任何锁时调用
+var (
+	cacheConfig  common.CacheConfig
+	cacheEntries = make(map[int64]*list.Element)
+	cacheOrder   = list.New()
+	cacheBytes   int64
+	cacheMutex   sync.Mutex
+)
+
+func init() {
+	cacheConfig = common.GetConfig().Cache
+}
+
+func GetCacheConfig() common.CacheConfig {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	return cacheConfig
+}
+
+// SetCacheConfig 校验并持久化缓存配置，立即淘汰超出新上限的请求
+func SetCacheConfig(cfg common.CacheConfig) error {
+	if cfg.MaxCount < 0 || cfg.MaxSizeMB < 0 {
+		return fmt.Errorf("cache limits must not be negative")
+	}
+	if cfg.Eviction == "" {
+		cfg.Eviction = common.CacheEvictionLRU
+	}
+	if cfg.Eviction != common.CacheEvictionLRU && cfg.Eviction != common.CacheEvictionAge {
+		return fmt.Errorf("unsupported eviction order: %s", cfg.Eviction)
+	}
+	if err := common.UpdateCacheConfig(cfg); err != nil {
+		return err
+	}
+
+	cacheMutex.Lock()
+	cacheConfig = cfg
+	evicted := evictLocked()
+	cacheMutex.Unlock()
+
+	releaseAll(evicted)
+	return nil
+}
+
+func GetCacheStats() CacheStats {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	stats := CacheStats{Count: len(cacheEntries), Bytes: cacheBytes}
+	for e := cacheOrder.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*cacheEntry)
+		if entry.pinned {
+			stats.Pinned++
+		}
+		if !entry.finished {
+			stats.Inflight++
+		}
+	}
+	return stats
+}
+
+// addToCache 加入新捕获的请求并淘汰超出上限的请求
+func addToCache(p *DataProxy, finished bool) {
+	cacheMutex.Lock()
+	size := int64(0)
+	if finished {
+		// 从持久化存储恢复的请求，body 在 Contents 中
+		size = int64(len(p.Contents.RequestBody) + len(p.Contents.ResponseBody))
+	}
+	cacheEntries[p.Id()] = cacheOrder.PushFront(&cacheEntry{proxy: p, size: size, finished: finished})
+	cacheBytes += size
+	evicted := evictLocked()
+	cacheMutex.Unlock()
+
+	releaseAll(evicted)
+}
+
+// getFromCache 返回缓存中的请求，按 LRU 淘汰时同时标记为最近使用
+func getFromCache(id int64) *DataProxy {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	e, ok := cacheEntries[id]
+	if !ok {
+		return nil
+	}
+	if cacheConfig.Eviction != common.CacheEvictionAge {
+		cacheOrder.MoveToFront(e)
+	}
+	return e.Value.(*cacheEntry).proxy
+}
+
+// growCache 记录请求 body 增长的大小，调用时不能持有任何 DataProxy 的锁
+func growCache(p *DataProxy, delta int64) {
+	if delta == 0 {
+		return
+	}
+
+	cacheMutex.Lock()
+	if e, ok := cacheEntries[p.Id()]; ok {
+		e.Value.(*cacheEntry).size += delta
+		cacheBytes += delta
+	}
+	evicted := evictLocked()
+	cacheMutex.Unlock()
+
+	releaseAll(evicted)
+}
+
+// markCacheFinished 请求结束后才允许被淘汰
+func markCacheFinished(p *DataProxy) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if e, ok := cacheEntries[p.Id()]; ok {
+		e.Value.(*cacheEntry).finished = true
+	}
+}
+
+// evictLocked 从最旧的请求开始移出缓存，直到满足上限，返回需要释放的请求，需要持有 cacheMutex
+func evictLocked() []*DataProxy {
+	maxBytes := int64(cacheConfig.MaxSizeMB) * 1024 * 1024
+	over := func() bool {
+		return (cacheConfig.MaxCount > 0 && len(cacheEntries) > cacheConfig.MaxCount) ||
+			(maxBytes > 0 && cacheBytes > maxBytes)
+	}
+
+	var evicted []*DataProxy
+	for e := cacheOrder.Back(); e != nil && over(); {
+		prev := e.Prev()
+		entry := e.Value.(*cacheEntry)
+		if !entry.pinned && entry.finished {
+			cacheOrder.Remove(e)
+			delete(cacheEntries, entry.proxy.Id())
+			cacheBytes -= entry.size
+			evicted = append(evicted, entry.proxy)
+		}
+		e = prev
+	}
+	return evicted
+}
+
+func releaseAll(proxies []*DataProxy) {
+	for _, p := range proxies {
+		p.release()
+	}
+}
+
+// PinProxy 固定或取消固定请求，固定的请求不会被移出内存缓存。
+// 已被淘汰的请求会从持久化存储中重新加载
+func PinProxy(id int64, pinned bool) error {
+	p := getFromCache(id)
+	if p == nil {
+		if !pinned {
+			return nil
+		}
+		if p = loadProxy(id); p == nil {
+			return fmt.Errorf("request %d not found", id)
+		}
+		addToCache(p, true)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	cacheMutex.Lock()
+	e, ok := cacheEntries[id]
+	if ok {
+		e.Value.(*cacheEntry).pinned = pinned
+	}
+	cacheMutex.Unlock()
+	if !ok {
+		return fmt.Errorf("request %d has been evicted", id)
+	}
+
+	p.Contents.Pinned = pinned
+	common.ReqSummary.BoardCast(p.Contents.RequestSummary)
+	return nil
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ComposeListener 构造请求记录的监听名称
+const ComposeListener = "compose"
+
+const (
+	defaultComposeTimeout = 30 * time.Second
+	maxComposeTimeout     = 10 * time.Minute
+)
+
+// ComposeRequest 手工构造的请求
+type ComposeRequest struct {
+	Method          string            // 默认 GET
+	URL             string            // http 或 https 的绝对地址
+	Headers         map[string]string // Host 用于覆盖请求的 Host
+	Body            []byte
+	HTTPVersion     string        // 1.1、2，为空时自动协商（HTTPS 优先使用 HTTP/2）
+	Timeout         time.Duration // 包括读取响应 body，默认 30 秒
+	FollowRedirects bool
+}
+
+// Compose 经上游代理发送手工构造的请求，并像代理的请求一样记录，等待响应结束后返回
+func Compose(ctx context.Context, req ComposeRequest) (SendResult, error) {
+	method := strings.ToUpper(strings.TrimSpace(req.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil {
+		return SendResult{}, fmt.Errorf("invalid url: %w", err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return SendResult{}, fmt.Errorf("invalid url %q: must be http(s)://host/path", req.URL)
+	}
+	if _, err := http.NewRequest(method, req.URL, nil); err != nil {
+		return SendResult{}, err
+	}
+
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = defaultComposeTimeout
+	}
+	if timeout < 0 || timeout > maxComposeTimeout {
+		return SendResult{}, fmt.Errorf("timeout must be between 0 and %s", maxComposeTimeout)
+	}
+
+	transport := upstreamTransport()
+	switch req.HTTPVersion {
+	case "":
+	case "1.1":
+		transport.Protocols = &http.Protocols{}
+		transport.Protocols.SetHTTP1(true)
+	case "2":
+		// HTTP 明文使用 h2c（prior knowledge），服务端必须支持
+		transport.Protocols = &http.Protocols{}
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		return SendResult{}, fmt.Errorf("unsupported http version %q, must be 1.1 or 2", req.HTTPVersion)
+	}
+
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	if !req.FollowRedirects {
+		client.CheckRedirect = noRedirect
+	}
+	defer client.CloseIdleConnections()
+
+	header := http.Header{}
+	for name, value := range req.Headers {
+		header.Set(name, value)
+	}
+	cleanHeader(header)
+
+	outgoing := &outgoingRequest{
+		method:   method,
+		url:      req.URL,
+		header:   header,
+		body:     req.Body,
+		listener: ComposeListener,
+	}
+	return outgoing.send(ctx, client), nil
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connTracker 记录监听上所有活动的客户端连接。
+// http.Server.Shutdown 不会等待被 Hijack 的连接（CONNECT 隧道），
+// 因此在 Accept 时包装连接，由连接自己在关闭时注销。
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[*trackedConn]struct{})}
+}
+
+// trackedConn 连接关闭时自动从 connTracker 中移除
+type trackedConn struct {
+	net.Conn
+	tracker  *connTracker
+	once     sync.Once
+	hijacked atomic.Bool
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.mu.Lock()
+		delete(c.tracker.conns, c)
+		c.tracker.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// trackingListener 包装 Accept 返回的连接
+type trackingListener struct {
+	net.Listener
+	tracker *connTracker
+}
+
+func (l trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: conn, tracker: l.tracker}
+	l.tracker.mu.Lock()
+	l.tracker.conns[tc] = struct{}{}
+	l.tracker.mu.Unlock()
+	return tc, nil
+}
+
+func (t *connTracker) listen(listener net.Listener) net.Listener {
+	return trackingListener{Listener: listener, tracker: t}
+}
+
+// counts 返回活动连接数和其中被 Hijack 的隧道连接数
+func (t *connTracker) counts() (active int, tunnels int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c := range t.conns {
+		if c.hijacked.Load() {
+			tunnels++
+		}
+	}
+	return len(t.conns), tunnels
+}
+
+// wait 等待所有连接关闭，超时返回 ctx 的错误
+func (t *connTracker) wait(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if active, _ := t.counts(); active == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeAll 强制关闭所有剩余连接
+func (t *connTracker) closeAll() {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// markHijacked 标记连接已被 Hijack 为隧道
+func markHijacked(conn net.Conn) {
+	if tc, ok := conn.(*trackedConn); ok {
+		tc.hijacked.Store(true)
+	}
+}
+
+// unwrapConn 返回被包装的原始连接
+func unwrapConn(conn net.Conn) net.Conn {
+	if tc, ok := conn.(*trackedConn); ok {
+		return tc.Conn
+	}
+	return conn
+}
@@ -1,48 +1,41 @@
 package proxy
 
 import (
-	"container/list"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"proxyMan/server/common"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-type DataCb func(dataType common.DataType, data []byte, timestamp time.Time, finished bool)
+// DataCb 接收推送的数据，返回错误时停止推送
+type DataCb func(dataType common.DataType, data []byte, timestamp time.Time, finished bool) error
 
-const (
-	cacheSize   = 1000
-	maxBodySize = 100 * 1024 * 1024 //100MM
-)
-
-var bodyMaxMsg = &(list.List{})
-
-func init() {
-	bodyMaxMsg.PushBack([]byte("Body too large!"))
-}
+// 详情推送每次读取的 body 大小
+const streamChunkSize = 64 * 1024
 
 var maxIndex int64 = 0
-var proxy = make([]*DataProxy, cacheSize)
-var proxyMutex = &sync.RWMutex{} // 保护全局proxy数组的读写锁
 
 type DataProxy struct {
 	Contents *common.HttpContents
 	Finished bool
 	state    common.DataType
-	reqBody  *list.List
-	respBody *list.List
-	bodySize int
+	reqBody  *bodyBuffer // 从持久化存储恢复的请求为 nil，body 在 Contents 中
+	respBody *bodyBuffer
 	lock     *sync.Mutex
 	cond     *sync.Cond
 	error    error
 }
 
-func NewDataProxy() *DataProxy {
+// NewDataProxy 创建请求记录，listener 为捕获该请求的监听名称
+func NewDataProxy(listener string) *DataProxy {
 	id := atomic.AddInt64(&maxIndex, 1)
 	now := time.Now()
 	data := &DataProxy{
@@ -51,33 +44,26 @@ func NewDataProxy() *DataProxy {
 				ID:        id,
 				StartTime: &now,
 				EndTime:   nil,
+				Listener:  listener,
 			},
 		},
 		state:    -1,
-		reqBody:  &list.List{},
-		respBody: &list.List{},
+		reqBody:  &bodyBuffer{},
+		respBody: &bodyBuffer{},
 		lock:     &sync.Mutex{},
 	}
 	data.cond = sync.NewCond(data.lock)
 
-	// 使用写锁保护全局proxy数组
-	proxyMutex.Lock()
-	proxy[int(id%cacheSize)] = data
-	proxyMutex.Unlock()
-
+	addToCache(data, false)
 	return data
 }
 
+// GetProxy 返回指定 ID 的请求，已被移出内存缓存时从持久化存储中读取
 func GetProxy(id int64) *DataProxy {
-	// 使用读锁保护全局proxy数组访问
-	proxyMutex.RLock()
-	dataProxy := proxy[int(id%cacheSize)]
-	proxyMutex.RUnlock()
-
-	if dataProxy == nil || dataProxy.Id() != id {
-		return nil
+	if dataProxy := getFromCache(id); dataProxy != nil {
+		return dataProxy
 	}
-	return dataProxy
+	return loadProxy(id)
 }
 
 func (p *DataProxy) Id() int64 {
@@ -101,12 +87,13 @@ func (p *DataProxy) reportRequest(req *http.Request) {
 
 	var fullURL string
 	var protocol string
-	if req.URL.Scheme == "http" {
-		fullURL = "http://" + req.Host + req.URL.Path
+	if req.URL.Scheme == "http" || req.URL.Scheme == "https" {
+		// 绝对 URL（普通代理请求、反向代理改写后的请求）
+		fullURL = req.URL.Scheme + "://" + req.Host + req.URL.Path
 		if req.URL.RawQuery != "" {
 			fullURL += "?" + req.URL.RawQuery
 		}
-		protocol = "HTTP"
+		protocol = strings.ToUpper(req.URL.Scheme)
 	} else {
 		fullURL = "https://" + req.Host + req.URL.String()
 		protocol = "HTTPS"
@@ -133,6 +120,9 @@ func (p *DataProxy) reportResponse(resp *http.Response) {
 	p.Contents.ContentType = resp.Header.Get("Content-Type")
 	p.Contents.StatusCode = resp.StatusCode
 	p.Contents.ResponseHeaders = resp.Header
+	p.Contents.TLS = common.NewTLSInfo(resp.TLS)
+	now := time.Now()
+	p.Contents.Timing.ResponseStart = &now
 	p.state = common.ResponseHeader
 
 	p.cond.Broadcast()
@@ -141,34 +131,27 @@ func (p *DataProxy) reportResponse(resp *http.Response) {
 
 func (p *DataProxy) reportChunkData(dataType common.DataType, chunk []byte) {
 	p.lock.Lock()
-	defer p.lock.Unlock()
-
-	var bodyData *list.List
-	switch dataType {
-	case common.RequestBody:
-		bodyData = p.reqBody
-	case common.ResponseBody:
-		bodyData = p.respBody
-	}
-
-	if bodyData == nil {
+	body := p.body(dataType)
+	if body == nil {
+		p.lock.Unlock()
 		return
 	}
 
-	p.bodySize += len(chunk)
-	if p.bodySize > maxBodySize {
-		if bodyData == bodyMaxMsg {
-			return
-		}
-		p.reqBody = bodyMaxMsg
-	} else {
-		var chunkCopy []byte
-		chunkCopy = make([]byte, len(chunk))
-		copy(chunkCopy, chunk)
-		bodyData.PushBack(chunkCopy)
-		p.cond.Broadcast()
+	before := body.size
+	body.write(chunk)
+	if body.truncated && !p.Contents.BodyTruncated {
+		log.Printf("Body of request %d exceeds the size limit, the rest is not recorded", p.Id())
+		p.Contents.BodyTruncated = true
+	}
+	if body.truncated && dataType == common.RequestBody {
+		p.Contents.RequestBodyTruncated = true
 	}
+	grown := body.size - before
+	p.cond.Broadcast()
+	p.lock.Unlock()
 
+	// 可能淘汰其他请求，不能持有锁
+	growCache(p, grown)
 }
 
 func (p *DataProxy) reportEnd(dataType common.DataType) {
@@ -176,22 +159,25 @@ func (p *DataProxy) reportEnd(dataType common.DataType) {
 	defer p.lock.Unlock()
 
 	if dataType == common.RequestBody {
-		p.Contents.RequestBody = getBytes(p.reqBody)
-		p.reqBody = nil
-		p.state = common.RequestBody
-		p.bodySize = 0
+		p.Contents.RequestBody = p.reqBody.finish()
+		now := time.Now()
+		p.Contents.Timing.RequestSent = &now
+		// 服务端可能在读完请求 body 之前就已响应，状态不能回退
+		if p.state < common.RequestBody {
+			p.state = common.RequestBody
+		}
 	}
 
 	if dataType == common.ResponseBody {
 		p.Contents.Status = common.StatusCompleted
 		now := time.Now()
 		p.Contents.EndTime = &now
-		p.Contents.ResponseBody = getBytes(p.respBody)
-		p.respBody = nil
+		p.Contents.ResponseBody = p.respBody.finish()
 		p.Finished = true
 		// 修复：移除重复的状态设置，避免潜在的状态冲突
 		p.state = common.ResponseBody
-		p.bodySize = 0
+		p.persist()
+		markCacheFinished(p)
 	}
 
 	common.ReqSummary.BoardCast(p.Contents.RequestSummary)
@@ -212,6 +198,11 @@ func (p *DataProxy) reportError(error error) {
 	p.Contents.EndTime = &now
 	p.error = error
 	p.state = common.ERROR
+	p.reqBody.ended = true
+	p.respBody.ended = true
+	p.Contents.Error = error.Error()
+	p.persist()
+	markCacheFinished(p)
 
 	// Broadcast error summary
 	common.ReqSummary.BoardCast(p.Contents.RequestSummary)
@@ -219,145 +210,184 @@ func (p *DataProxy) reportError(error error) {
 	return
 }
 
-func (p *DataProxy) OnData(cb DataCb) {
-	//RequestHeader
-	p.waitStatusChange(common.RequestHeader)
-	if p.checkError(cb) {
-		return
-	}
-	data, err := json.Marshal(p.Contents.RequestHeaders)
+// OnData 依次推送请求头、请求 body、响应头、响应 body 和摘要，数据还未到达时等待。
+// cb 返回错误或 ctx 取消时停止并返回该错误；请求出错时推送 ERROR 后返回 nil
+func (p *DataProxy) OnData(ctx context.Context, cb DataCb) error {
+	err := p.sendHeader(ctx, common.RequestHeader, cb)
 	if err == nil {
-		cb(common.RequestHeader, data, time.Now(), true)
-	} else {
-		cb(common.RequestHeader, []byte{}, time.Now(), true)
+		err = p.sendBody(ctx, common.RequestBody, 0, -1, cb)
 	}
-
-	//RequestBody
-	p.processBodyData(common.RequestBody, cb)
-	if p.checkError(cb) {
-		return
+	if err == nil {
+		err = p.sendHeader(ctx, common.ResponseHeader, cb)
 	}
-
-	//ResponseHeader
-	p.waitStatusChange(common.ResponseHeader)
-	if p.checkError(cb) {
-		return
+	if err == nil {
+		err = p.sendBody(ctx, common.ResponseBody, 0, -1, cb)
 	}
-	data, err = json.Marshal(p.Contents.ResponseHeaders)
 	if err == nil {
-		cb(common.ResponseHeader, data, time.Now(), true)
-	} else {
-		cb(common.ResponseHeader, []byte{}, time.Now(), true)
+		p.lock.Lock()
+		data, marshalErr := json.Marshal(p.Contents.RequestSummary)
+		p.lock.Unlock()
+		if marshalErr != nil {
+			data = []byte{}
+		}
+		err = cb(common.Metadata, data, time.Now(), true)
 	}
 
-	//ResponseBody
-	p.processBodyData(common.ResponseBody, cb)
-	if p.checkError(cb) {
-		return
+	if errors.Is(err, errRequestFailed) {
+		return nil
 	}
+	return err
+}
 
-	data, err = json.Marshal(p.Contents.RequestSummary)
-	if err == nil {
-		cb(common.Metadata, data, time.Now(), true)
-	} else {
-		cb(common.Metadata, []byte{}, time.Now(), true)
+// OnBodyRange 推送请求或响应 body 中 [start, end] 范围内的数据，end 为 -1 时直到 body 结束。
+// 数据还未到达时等待，请求出错时最后推送 ERROR
+func (p *DataProxy) OnBodyRange(ctx context.Context, dataType common.DataType, start, end int64, cb DataCb) error {
+	err := p.sendBody(ctx, dataType, start, end, cb)
+	if errors.Is(err, errRequestFailed) {
+		return nil
 	}
+	return err
 }
 
-func (p *DataProxy) checkError(cb DataCb) bool {
-	if p.state == common.ERROR {
-		cb(common.ERROR, []byte(p.error.Error()), time.Now(), true)
-		return true
+// errRequestFailed 请求出错，已推送 ERROR
+var errRequestFailed = errors.New("request failed")
+
+// sendHeader 等待并推送请求头或响应头
+func (p *DataProxy) sendHeader(ctx context.Context, dataType common.DataType, cb DataCb) error {
+	if err := p.waitStatusChange(ctx, dataType); err != nil {
+		return err
+	}
+	if err := p.checkError(cb); err != nil {
+		return err
 	}
-	return false
-}
 
-func (p *DataProxy) processBodyData(dataType common.DataType, cb DataCb) {
 	p.lock.Lock()
-	defer p.lock.Unlock()
-	if p.state >= dataType {
-		var data []byte
-		if dataType == common.RequestBody {
-			data = p.Contents.RequestBody
-		} else if dataType == common.ResponseBody {
-			data = p.Contents.ResponseBody
-		} else {
-			data = []byte{}
+	headers := p.Contents.RequestHeaders
+	if dataType == common.ResponseHeader {
+		headers = p.Contents.ResponseHeaders
+	}
+	data, err := json.Marshal(headers)
+	p.lock.Unlock()
+	if err != nil {
+		data = []byte{}
+	}
+	return cb(dataType, data, time.Now(), true)
+}
+
+// sendBody 通过游标推送 body，推送时不持有锁，避免阻塞代理转发
+func (p *DataProxy) sendBody(ctx context.Context, dataType common.DataType, start, end int64, cb DataCb) error {
+	cursor := p.Subscribe(ctx, dataType, start, end)
+	defer cursor.Close()
+	for {
+		data, finished, err := cursor.Next()
+		if err != nil {
+			return err
 		}
-		cb(dataType, data, time.Now(), true)
-	} else {
-		oldState := p.state
-		var bodyList *list.List
-		if dataType == common.RequestBody {
-			bodyList = p.reqBody
-		} else if dataType == common.ResponseBody {
-			bodyList = p.respBody
-		} else {
-			return
+		if err := cb(dataType, data, time.Now(), finished); err != nil {
+			return err
 		}
-
-		if bodyList.Front() == nil {
-			p.cond.Wait()
+		if finished {
+			return p.checkError(cb)
 		}
+	}
+}
 
-		for e := bodyList.Front(); e != nil; e = e.Next() {
-			// list.List 的元素是 interface{}，需要进行类型断言
-			chunk, ok := e.Value.([]byte)
-			if !ok {
-				// 如果链表中存储了非 []byte 类型的数据，返回错误
-				fmt.Printf("body list contains a non-[]byte element of type %T\n", e.Value)
-				return
-			}
-			cb(dataType, chunk, time.Now(), false)
-
-			if e.Next() == nil {
-				p.cond.Wait()
-				if p.state != oldState {
-					cb(dataType, []byte{}, time.Now(), true)
-					break
-				}
-			}
-		}
+// checkError 请求出错时推送 ERROR 并返回 errRequestFailed
+func (p *DataProxy) checkError(cb DataCb) error {
+	p.lock.Lock()
+	failed, reason := p.state == common.ERROR, ""
+	if failed {
+		reason = p.error.Error()
+	}
+	p.lock.Unlock()
+
+	if !failed {
+		return nil
 	}
+	if err := cb(common.ERROR, []byte(reason), time.Now(), true); err != nil {
+		return err
+	}
+	return errRequestFailed
 }
 
-func (p *DataProxy) waitStatusChange(datatype common.DataType) {
+// waitStatusChange 等待请求进入 datatype 阶段或出错，ctx 取消时返回 ctx.Err()
+func (p *DataProxy) waitStatusChange(ctx context.Context, datatype common.DataType) error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		p.cond.Broadcast()
+	})
+	defer stop()
+
 	for p.state < datatype && p.state != common.ERROR {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		p.cond.Wait()
 	}
+	return nil
 }
 
-// 优化的getBytes函数：单次遍历，提高性能
-func getBytes(list *list.List) []byte {
-	if list == nil || list.Len() == 0 {
-		return nil
+func (p *DataProxy) body(dataType common.DataType) *bodyBuffer {
+	switch dataType {
+	case common.RequestBody:
+		return p.reqBody
+	case common.ResponseBody:
+		return p.respBody
 	}
+	return nil
+}
 
-	var totalSize int
-	for e := list.Front(); e != nil; e = e.Next() {
-		chunk, ok := e.Value.([]byte)
-		if !ok {
-			// 使用log.Printf而不是fmt.Println提高错误处理
-			log.Printf("list contains a non-[]byte element of type %T", e.Value)
-			return nil
-		}
-		totalSize += len(chunk)
+func (p *DataProxy) storedBody(dataType common.DataType) []byte {
+	if dataType == common.RequestBody {
+		return p.Contents.RequestBody
 	}
+	return p.Contents.ResponseBody
+}
 
-	if totalSize == 0 {
-		return nil
+// Body 返回已记录的完整请求或响应 body，写入临时文件的 body 从文件读取
+func (p *DataProxy) Body(dataType common.DataType) []byte {
+	p.lock.Lock()
+	body := p.body(dataType)
+	if body == nil {
+		defer p.lock.Unlock()
+		return p.storedBody(dataType)
 	}
+	read := body.snapshot()
+	p.lock.Unlock()
+	return read()
+}
 
-	// 一次性分配内存并复制
-	result := make([]byte, totalSize)
-	pos := 0
-	for e := list.Front(); e != nil; e = e.Next() {
-		chunk := e.Value.([]byte)
-		copy(result[pos:], chunk)
-		pos += len(chunk)
+// Snapshot 返回请求的完整副本，包括写入临时文件的 body
+func (p *DataProxy) Snapshot() *common.HttpContents {
+	p.lock.Lock()
+	contents := *p.Contents
+	var readRequestBody, readResponseBody func() []byte
+	if p.reqBody != nil {
+		readRequestBody, readResponseBody = p.reqBody.snapshot(), p.respBody.snapshot()
+	}
+	p.lock.Unlock()
+
+	if readRequestBody != nil {
+		contents.RequestBody = readRequestBody()
+		contents.ResponseBody = readResponseBody()
 	}
+	return &contents
+}
+
+// release 释放 body 占用的内存和临时文件
+func (p *DataProxy) release() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
-	return result
+	if p.reqBody != nil {
+		p.reqBody.release()
+	}
+	if p.respBody != nil {
+		p.respBody.release()
+	}
+	p.cond.Broadcast()
 }
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"proxyMan/server/common"
+	"sync/atomic"
+)
+
+// ImportRequest 导入外部的请求记录（例如 HAR、会话文件），分配新的 ID 并标记为导入，保留原始时间，返回新的 ID。
+// body 从 requestBody 和 responseBody 读取（可以为 nil），与捕获的请求一样受单个 body 上限限制，较大的 body 写入临时文件。
+// 导入的请求只读，和从持久化存储恢复的请求一样在列表和详情中查看
+func ImportRequest(c *common.HttpContents, requestBody, responseBody io.Reader) int64 {
+	c.ID = atomic.AddInt64(&maxIndex, 1)
+	c.Imported = true
+	c.Pinned = false
+	c.RequestBody = nil
+	c.ResponseBody = nil
+	if c.Status != common.StatusError {
+		c.Status = common.StatusCompleted
+	}
+
+	p := newStoredProxy(c)
+	p.reqBody = &bodyBuffer{}
+	p.respBody = &bodyBuffer{}
+	// 读取 body 期间按未结束的请求处理，不会被淘汰
+	addToCache(p, false)
+
+	err := p.importBody(common.RequestBody, requestBody)
+	if err == nil {
+		err = p.importBody(common.ResponseBody, responseBody)
+	}
+
+	p.lock.Lock()
+	c.RequestBody = p.reqBody.finish()
+	c.ResponseBody = p.respBody.finish()
+	if err != nil {
+		log.Printf("Failed to import body of request %d: %v", c.ID, err)
+		c.Status = common.StatusError
+		c.Error = fmt.Sprintf("failed to import body: %v", err)
+		p.state = common.ERROR
+		p.error = errors.New(c.Error)
+	}
+	p.persist()
+	summary := c.RequestSummary
+	p.lock.Unlock()
+	markCacheFinished(p)
+
+	common.ReqSummary.BoardCast(summary)
+	return c.ID
+}
+
+// importBody 分段写入 body，与捕获时一样计入内存缓存
+func (p *DataProxy) importBody(dataType common.DataType, body io.Reader) error {
+	if body == nil {
+		return nil
+	}
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			// reportChunkData 会复制数据
+			p.reportChunkData(dataType, buf[:n])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"proxyMan/server/common"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// listenerCtxKey 保存在请求 context 中的监听名称
+type listenerCtxKey struct{}
+
+// DefaultDrainTimeout 停止或重启监听时等待进行中请求完成的默认时间
+const DefaultDrainTimeout = 30 * time.Second
+
+// runningListener 一个正在运行（或启动失败）的代理监听
+type runningListener struct {
+	config   common.ListenerConfig
+	listener net.Listener
+	server   *http.Server // http / reverse 模式使用
+	conns    *connTracker
+	err      error
+}
+
+// ListenerStatus 代理监听的配置和运行状态
+type ListenerStatus struct {
+	common.ListenerConfig
+	Running     bool   `json:"running"`
+	Draining    bool   `json:"draining"`     // 是否有旧监听正在等待连接结束
+	ActiveConns int    `json:"active_conns"` // 活动连接数，包括正在排空的旧监听
+	Tunnels     int    `json:"tunnels"`      // 其中被 Hijack 的 CONNECT 隧道数
+	Error       string `json:"error,omitempty"`
+}
+
+var (
+	listeners      = make(map[string]*runningListener)
+	draining       = make(map[*runningListener]struct{}) // 已停止接受新连接、等待排空的监听
+	listenersMutex sync.Mutex
+)
+
+func listenerFromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(listenerCtxKey{}).(string); ok {
+		return name
+	}
+	return ""
+}
+
+// StartListeners 启动配置中所有已启用的监听
+func StartListeners(configs []common.ListenerConfig) {
+	for _, cfg := range configs {
+		if !cfg.Enabled {
+			continue
+		}
+		if err := StartListener(cfg); err != nil {
+			log.Printf("Failed to start listener %s: %v", cfg.Name, err)
+		}
+	}
+}
+
+// StartListener 启动（或重启）一个代理监听
+func StartListener(cfg common.ListenerConfig) error {
+	if cfg.Name == "" {
+		return errors.New("listener name is required")
+	}
+
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+
+	// 重启时先关闭旧监听释放端口，旧连接在后台继续排空
+	if old, ok := listeners[cfg.Name]; ok {
+		old.stopAccepting()
+		delete(listeners, cfg.Name)
+		draining[old] = struct{}{}
+		go finishDrain(old, DefaultDrainTimeout)
+	}
+
+	rl := &runningListener{config: cfg, conns: newConnTracker()}
+	listeners[cfg.Name] = rl
+	if err := rl.start(); err != nil {
+		log.Printf("Failed to start listener %s on %s:%d cause %v", cfg.Name, cfg.Host, cfg.Port, err)
+		rl.err = err
+		return err
+	}
+	return nil
+}
+
+// StopListener 优雅停止指定名称的代理监听：立即拒绝新连接，
+// 等待进行中的请求和隧道结束，超过 timeout 后强制关闭剩余连接
+func StopListener(name string, timeout time.Duration) {
+	listenersMutex.Lock()
+	rl, ok := listeners[name]
+	if ok {
+		rl.stopAccepting()
+		delete(listeners, name)
+		draining[rl] = struct{}{}
+	}
+	listenersMutex.Unlock()
+
+	if ok {
+		finishDrain(rl, timeout)
+	}
+}
+
+// finishDrain 等待监听上的连接排空
+func finishDrain(rl *runningListener, timeout time.Duration) {
+	rl.drain(timeout)
+
+	listenersMutex.Lock()
+	delete(draining, rl)
+	listenersMutex.Unlock()
+}
+
+// GetListeners 返回所有监听的配置和运行状态，顺序与配置一致
+func GetListeners() []ListenerStatus {
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+
+	result := make([]ListenerStatus, 0)
+	for _, cfg := range common.GetConfig().Listeners {
+		result = append(result, statusOf(cfg))
+	}
+	return result
+}
+
+// GetListener 返回指定监听的运行状态，正在运行时返回实际使用的配置
+func GetListener(name string) (ListenerStatus, bool) {
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+
+	if rl, ok := listeners[name]; ok {
+		return statusOf(rl.config), true
+	}
+	cfg, ok := common.GetListenerConfig(name)
+	if !ok {
+		return ListenerStatus{}, false
+	}
+	return statusOf(cfg), true
+}
+
+// statusOf 需要持有 listenersMutex
+func statusOf(cfg common.ListenerConfig) ListenerStatus {
+	status := ListenerStatus{ListenerConfig: cfg}
+	if rl, ok := listeners[cfg.Name]; ok {
+		// 命令行参数可能覆盖了监听地址，以实际运行的为准
+		status.ListenerConfig = rl.config
+		status.Running = rl.listener != nil && rl.err == nil
+		if rl.err != nil {
+			status.Error = rl.err.Error()
+		}
+		status.ActiveConns, status.Tunnels = rl.conns.counts()
+	}
+	for old := range draining {
+		if old.config.Name == cfg.Name {
+			active, tunnels := old.conns.counts()
+			status.Draining = true
+			status.ActiveConns += active
+			status.Tunnels += tunnels
+		}
+	}
+	return status
+}
+
+func (rl *runningListener) start() error {
+	cfg := rl.config
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	var listener net.Listener
+	var err error
+	switch cfg.Mode {
+	case common.ListenerModeHTTP, common.ListenerModeSocks:
+		listener, err = net.Listen("tcp", addr)
+	case common.ListenerModeTransparent:
+		listener, err = listenTransparent(addr, cfg.TProxy)
+	case common.ListenerModeReverse:
+		var handler *reverseHandler
+		handler, err = newReverseHandler(cfg)
+		if err != nil {
+			return err
+		}
+		listener, err = net.Listen("tcp", addr)
+		if err == nil {
+			listener = rl.conns.listen(accessListener{Listener: listener, name: cfg.Name})
+			if cfg.TLS {
+				listener = tlsListener(listener, cfg.Host)
+			}
+			rl.server = &http.Server{Handler: handler}
+		}
+	default:
+		return fmt.Errorf("unsupported listener mode %s", cfg.Mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	if cfg.Mode == common.ListenerModeHTTP {
+		rl.server = &http.Server{
+			Handler: http.HandlerFunc(HandleHTTP),
+			ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+				return context.WithValue(ctx, listenerCtxKey{}, cfg.Name)
+			},
+		}
+	}
+
+	if cfg.Mode != common.ListenerModeReverse {
+		listener = rl.conns.listen(accessListener{Listener: listener, name: cfg.Name})
+	}
+	rl.listener = listener
+	go rl.serve()
+	return nil
+}
+
+func (rl *runningListener) serve() {
+	cfg := rl.config
+	log.Printf("Starting %s listener %s on %s", cfg.Mode, cfg.Name, rl.listener.Addr().String())
+
+	var err error
+	switch cfg.Mode {
+	case common.ListenerModeSocks:
+		err = serveSocks(rl.listener, cfg.Name)
+	case common.ListenerModeTransparent:
+		err = serveTransparent(rl.listener, cfg.Name)
+	default:
+		err = rl.server.Serve(rl.listener)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Listener %s stopped unexpectedly: %v", cfg.Name, err)
+		listenersMutex.Lock()
+		if listeners[cfg.Name] == rl {
+			rl.err = err
+		}
+		listenersMutex.Unlock()
+	}
+}
+
+// stopAccepting 关闭监听端口，不再接受新连接，需要持有 listenersMutex
+func (rl *runningListener) stopAccepting() {
+	if rl.server != nil {
+		// 正在处理的请求完成后关闭连接，不再复用
+		rl.server.SetKeepAlivesEnabled(false)
+	}
+	if rl.listener != nil {
+		_ = rl.listener.Close()
+	}
+}
+
+// drain 等待进行中的请求和隧道结束，超时后强制关闭
+func (rl *runningListener) drain(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if active, tunnels := rl.conns.counts(); active > 0 {
+		log.Printf("Draining listener %s: %d active connections (%d tunnels)", rl.config.Name, active, tunnels)
+	}
+
+	// Shutdown 关闭空闲连接并等待普通请求完成，被 Hijack 的隧道由 connTracker 等待
+	if rl.server != nil {
+		_ = rl.server.Shutdown(ctx)
+	}
+	if err := rl.conns.wait(ctx); err != nil {
+		active, _ := rl.conns.counts()
+		log.Printf("Listener %s drain timeout, closing %d connections", rl.config.Name, active)
+		rl.conns.closeAll()
+	}
+	if rl.server != nil {
+		_ = rl.server.Close()
+	}
+	log.Printf("Listener %s stopped", rl.config.Name)
+}
+
+// GetCurrentProxyHost 返回默认 HTTP 代理监听地址
+func GetCurrentProxyHost() string {
+	status, _ := GetListener(common.DefaultListener)
+	return status.Host
+}
+
+// GetCurrentProxyPort 返回默认 HTTP 代理监听端口
+func GetCurrentProxyPort() int {
+	status, _ := GetListener(common.DefaultListener)
+	return status.Port
+}
@@ -0,0 +1,655 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	pacReloadInterval = 30 * time.Second // PAC 文件变更检测间隔
+	pacCacheTTL       = 5 * time.Minute  // FindProxyForURL 结果缓存时间
+	pacMaxCacheSize   = 1000             // 最大缓存条目数
+	pacFetchTimeout   = 10 * time.Second // 远程 PAC 下载超时
+	pacEvalTimeout    = 5 * time.Second  // 单次 FindProxyForURL 的执行上限
+	pacDNSTimeout     = 2 * time.Second  // dnsResolve 等 DNS 查询超时
+	pacPoolSize       = 4                // 保留的空闲 JS 运行时数量
+)
+
+// pacUtils 标准 PAC 辅助函数的 JS 实现（参考 Mozilla pac_utils.js），
+// dnsResolve / myIpAddress 由 Go 侧注入。
+const pacUtils = `
+function dnsDomainIs(host, domain) {
+    return (host.length >= domain.length &&
+            host.substring(host.length - domain.length) == domain);
+}
+function dnsDomainLevels(host) {
+    return host.split('.').length - 1;
+}
+function isValidIpAddress(ipchars) {
+    var matches = /^(\d{1,3})\.(\d{1,3})\.(\d{1,3})\.(\d{1,3})$/.exec(ipchars);
+    if (matches == null) {
+        return false;
+    } else if (matches[1] > 255 || matches[2] > 255 ||
+               matches[3] > 255 || matches[4] > 255) {
+        return false;
+    }
+    return true;
+}
+function convert_addr(ipchars) {
+    var bytes = ipchars.split('.');
+    var result = ((bytes[0] & 0xff) << 24) |
+                 ((bytes[1] & 0xff) << 16) |
+                 ((bytes[2] & 0xff) <<  8) |
+                  (bytes[3] & 0xff);
+    return result;
+}
+function isInNet(ipaddr, pattern, maskstr) {
+    if (!isValidIpAddress(pattern) || !isValidIpAddress(maskstr)) {
+        return false;
+    }
+    if (!isValidIpAddress(ipaddr)) {
+        ipaddr = dnsResolve(ipaddr);
+        if (ipaddr == null) {
+            return false;
+        }
+    }
+    var host = convert_addr(ipaddr);
+    var pat  = convert_addr(pattern);
+    var mask = convert_addr(maskstr);
+    return ((host & mask) == (pat & mask));
+}
+function isPlainHostName(host) {
+    return (host.search('\\.') == -1);
+}
+function isResolvable(host) {
+    var ip = dnsResolve(host);
+    return (ip != null);
+}
+function localHostOrDomainIs(host, hostdom) {
+    return (host == hostdom) ||
+           (hostdom.lastIndexOf(host + '.', 0) == 0);
+}
+function shExpMatch(url, pattern) {
+    pattern = pattern.replace(/\./g, '\\.');
+    pattern = pattern.replace(/\*/g, '.*');
+    pattern = pattern.replace(/\?/g, '.');
+    var newRe = new RegExp('^' + pattern + '$');
+    return newRe.test(url);
+}
+var wdays = {SUN: 0, MON: 1, TUE: 2, WED: 3, THU: 4, FRI: 5, SAT: 6};
+var months = {JAN: 0, FEB: 1, MAR: 2, APR: 3, MAY: 4, JUN: 5, JUL: 6, AUG: 7, SEP: 8, OCT: 9, NOV: 10, DEC: 11};
+function weekdayRange() {
+    function getDay(weekday) {
+        if (weekday in wdays) {
+            return wdays[weekday];
+        }
+        return -1;
+    }
+    var date = new Date();
+    var argc = arguments.length;
+    var wday;
+    if (argc < 1)
+        return false;
+    if (arguments[argc - 1] == 'GMT') {
+        argc--;
+        wday = date.getUTCDay();
+    } else {
+        wday = date.getDay();
+    }
+    var wd1 = getDay(arguments[0]);
+    var wd2 = (argc == 2) ? getDay(arguments[1]) : wd1;
+    if (wd1 == -1 || wd2 == -1)
+        return false;
+    if (wd1 <= wd2)
+        return (wd1 <= wday && wday <= wd2);
+    return (wd2 >= wday || wday >= wd1);
+}
+function dateRange() {
+    function getMonth(name) {
+        if (name in months) {
+            return months[name];
+        }
+        return -1;
+    }
+    var date = new Date();
+    var argc = arguments.length;
+    if (argc < 1) {
+        return false;
+    }
+    var isGMT = (arguments[argc - 1] == 'GMT');
+    if (isGMT) {
+        argc--;
+    }
+    if (argc == 1) {
+        var tmp = parseInt(arguments[0]);
+        if (isNaN(tmp)) {
+            return ((isGMT ? date.getUTCMonth() : date.getMonth()) == getMonth(arguments[0]));
+        } else if (tmp < 32) {
+            return ((isGMT ? date.getUTCDate() : date.getDate()) == tmp);
+        } else {
+            return ((isGMT ? date.getUTCFullYear() : date.getFullYear()) == tmp);
+        }
+    }
+    var year = date.getFullYear();
+    var date1, date2;
+    date1 = new Date(year, 0, 1, 0, 0, 0);
+    date2 = new Date(year, 11, 31, 23, 59, 59);
+    var adjustMonth = false;
+    for (var i = 0; i < (argc >> 1); i++) {
+        var tmp = parseInt(arguments[i]);
+        if (isNaN(tmp)) {
+            var mon = getMonth(arguments[i]);
+            date1.setMonth(mon);
+        } else if (tmp < 32) {
+            adjustMonth = (argc <= 2);
+            date1.setDate(tmp);
+        } else {
+            date1.setFullYear(tmp);
+        }
+    }
+    for (var i = (argc >> 1); i < argc; i++) {
+        var tmp = parseInt(arguments[i]);
+        if (isNaN(tmp)) {
+            var mon = getMonth(arguments[i]);
+            date2.setMonth(mon);
+        } else if (tmp < 32) {
+            date2.setDate(tmp);
+        } else {
+            date2.setFullYear(tmp);
+        }
+    }
+    if (adjustMonth) {
+        date1.setMonth(date.getMonth());
+        date2.setMonth(date.getMonth());
+    }
+    if (isGMT) {
+        var tmp = date;
+        tmp.setFullYear(date.getUTCFullYear());
+        tmp.setMonth(date.getUTCMonth());
+        tmp.setDate(date.getUTCDate());
+        tmp.setHours(date.getUTCHours());
+        tmp.setMinutes(date.getUTCMinutes());
+        tmp.setSeconds(date.getUTCSeconds());
+        date = tmp;
+    }
+    return (date1 <= date2) ? (date1 <= date) && (date <= date2)
+                            : (date2 <= date) || (date <= date1);
+}
+function timeRange() {
+    var argc = arguments.length;
+    var date = new Date();
+    var isGMT = false;
+    if (argc < 1) {
+        return false;
+    }
+    if (arguments[argc - 1] == 'GMT') {
+        isGMT = true;
+        argc--;
+    }
+    var hour = isGMT ? date.getUTCHours() : date.getHours();
+    var date1, date2;
+    date1 = new Date();
+    date2 = new Date();
+    if (argc == 1) {
+        return (hour == arguments[0]);
+    } else if (argc == 2) {
+        return ((arguments[0] <= hour) && (hour <= arguments[1]));
+    } else {
+        switch (argc) {
+        case 6:
+            date1.setSeconds(arguments[2]);
+            date2.setSeconds(arguments[5]);
+        case 4:
+            var middle = argc >> 1;
+            date1.setHours(arguments[0]);
+            date1.setMinutes(arguments[1]);
+            date2.setHours(arguments[middle]);
+            date2.setMinutes(arguments[middle + 1]);
+            if (middle == 2) {
+                date2.setSeconds(59);
+            }
+            break;
+        default:
+            throw 'timeRange: bad number of arguments'
+        }
+    }
+    if (isGMT) {
+        date.setFullYear(date.getUTCFullYear());
+        date.setMonth(date.getUTCMonth());
+        date.setDate(date.getUTCDate());
+        date.setHours(date.getUTCHours());
+        date.setMinutes(date.getUTCMinutes());
+        date.setSeconds(date.getUTCSeconds());
+    }
+    return (date1 <= date2) ? (date1 <= date) && (date <= date2)
+                            : (date2 <= date) || (date <= date1);
+}
+`
+
+type pacCacheEntry struct {
+	proxyURL  *url.URL
+	expiresAt time.Time
+}
+
+// pacResolver 加载 PAC 脚本并对每个请求执行 FindProxyForURL
+type pacResolver struct {
+	source string
+
+	vmLock  sync.Mutex  // 保护 vms、script 和 loadErr
+	vms     chan *pacVM // 当前脚本的空闲运行时，为 nil 表示还没有加载成功
+	script  []byte
+	loadErr error // 最近一次加载失败的原因，加载成功后清空
+
+	reloadLock sync.Mutex // 保证同一时间只有一次重新加载
+	modTime    time.Time
+
+	cache     map[string]*pacCacheEntry
+	cacheLock sync.RWMutex
+
+	cancel context.CancelFunc
+}
+
+var (
+	currentPAC     *pacResolver
+	currentPACLock sync.Mutex
+)
+
+// newPACResolver 从文件路径或 URL 加载 PAC 脚本并启动变更检测。
+// 加载失败时同样返回 resolver，变更检测会继续重试，err 为首次加载失败的原因
+func newPACResolver(source string) (*pacResolver, error) {
+	r := &pacResolver{
+		source: source,
+		cache:  make(map[string]*pacCacheEntry),
+	}
+
+	_, err := r.reload()
+	if err == nil {
+		log.Printf("PAC script loaded from %s", source)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.watch(ctx)
+	return r, err
+}
+
+// loadPACSource 加载 source 对应的 PAC 脚本但不切换，changed 为 false 表示与当前使用的来源相同，
+// 之前加载失败时立即重试。返回的 resolver 交给 swapPACSource，放弃时需要 Close；source 为空时为 nil
+func loadPACSource(source string) (resolver *pacResolver, changed bool, err error) {
+	if current := getPACResolver(); current != nil && current.source == source {
+		if current.Err() == nil {
+			return nil, false, nil
+		}
+		_, err := current.reload()
+		return nil, false, err
+	}
+	if source == "" {
+		return nil, true, nil
+	}
+
+	resolver, err = newPACResolver(source)
+	if err != nil {
+		resolver.Close()
+		return nil, false, err
+	}
+	return resolver, true, nil
+}
+
+// swapPACSource 切换当前使用的 PAC 脚本，nil 表示停止使用 PAC
+func swapPACSource(resolver *pacResolver) {
+	currentPACLock.Lock()
+	defer currentPACLock.Unlock()
+	if currentPAC != nil {
+		currentPAC.Close()
+	}
+	currentPAC = resolver
+}
+
+// startPACSource 启动时使用配置中的 PAC 脚本，加载失败时仍然启用并在后台重试，
+// 加载成功之前经过 PAC 的请求返回错误，不会直连
+func startPACSource(source string) {
+	if source == "" {
+		return
+	}
+	resolver, err := newPACResolver(source)
+	if err != nil {
+		log.Printf("Failed to load pac script, retrying every %s: %v", pacReloadInterval, err)
+	}
+	swapPACSource(resolver)
+}
+
+// PACError 返回当前 PAC 脚本最近一次加载失败的原因，没有使用 PAC 或加载成功时为空
+func PACError() string {
+	if r := getPACResolver(); r != nil {
+		if err := r.Err(); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+func getPACResolver() *pacResolver {
+	currentPACLock.Lock()
+	defer currentPACLock.Unlock()
+	return currentPAC
+}
+
+// isRemotePAC 判断 PAC 来源是否为远程 URL
+func (r *pacResolver) isRemotePAC() bool {
+	return strings.HasPrefix(r.source, "http://") || strings.HasPrefix(r.source, "https://")
+}
+
+// fetch 读取 PAC 脚本内容，本地文件同时返回修改时间
+func (r *pacResolver) fetch() ([]byte, time.Time, error) {
+	if r.isRemotePAC() {
+		// 下载 PAC 时直连，避免依赖 PAC 本身
+		client := &http.Client{
+			Timeout:   pacFetchTimeout,
+			Transport: &http.Transport{Proxy: nil},
+		}
+		resp, err := client.Get(r.source)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to download pac %s: %w", r.source, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, time.Time{}, fmt.Errorf("failed to download pac %s: status %d", r.source, resp.StatusCode)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to read pac %s: %w", r.source, err)
+		}
+		return data, time.Time{}, nil
+	}
+
+	path := strings.TrimPrefix(r.source, "file://")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to stat pac file %s: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read pac file %s: %w", path, err)
+	}
+	return data, info.ModTime(), nil
+}
+
+// pacVM 加载了 PAC 脚本的 JS 运行时。goja.Runtime 不是并发安全的，
+// 每次执行从池中取出一个，并发请求之间不会互相等待（包括脚本中的 DNS 查询）
+type pacVM struct {
+	vm   *goja.Runtime
+	find goja.Callable
+}
+
+// compile 加载 PAC 脚本，成功后替换运行时池
+func (r *pacResolver) compile(script []byte) error {
+	v, err := newPACVM(r.source, script)
+	if err != nil {
+		return err
+	}
+	vms := make(chan *pacVM, pacPoolSize)
+	vms <- v
+
+	r.vmLock.Lock()
+	r.vms = vms
+	r.script = script
+	r.vmLock.Unlock()
+
+	r.cacheLock.Lock()
+	r.cache = make(map[string]*pacCacheEntry)
+	r.cacheLock.Unlock()
+	return nil
+}
+
+// newPACVM 创建新的 JS 运行时并加载 PAC 脚本
+func newPACVM(source string, script []byte) (*pacVM, error) {
+	vm := goja.New()
+	_ = vm.Set("dnsResolve", func(host string) goja.Value {
+		ip := pacDNSResolve(host)
+		if ip == "" {
+			return goja.Null()
+		}
+		return vm.ToValue(ip)
+	})
+	_ = vm.Set("myIpAddress", pacMyIPAddress)
+	_ = vm.Set("alert", func(msg string) {
+		log.Printf("PAC alert: %s", msg)
+	})
+
+	if _, err := vm.RunString(pacUtils); err != nil {
+		return nil, fmt.Errorf("failed to load pac utils: %w", err)
+	}
+	// 脚本顶层代码同样限制执行时间
+	timer := time.AfterFunc(pacEvalTimeout, func() { vm.Interrupt("timeout") })
+	_, err := vm.RunScript(source, string(script))
+	timer.Stop()
+	vm.ClearInterrupt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate pac script: %w", err)
+	}
+
+	find, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, errors.New("pac script does not define FindProxyForURL")
+	}
+	return &pacVM{vm: vm, find: find}, nil
+}
+
+// Err 返回最近一次加载失败的原因
+func (r *pacResolver) Err() error {
+	r.vmLock.Lock()
+	defer r.vmLock.Unlock()
+	return r.loadErr
+}
+
+// reload 读取 PAC 脚本，内容变化或之前没有加载成功时重新编译，返回是否重新编译。
+// 失败时记录原因，已加载的旧脚本继续工作
+func (r *pacResolver) reload() (bool, error) {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	script, modTime, err := r.fetch()
+	if err == nil {
+		r.vmLock.Lock()
+		loaded := r.vms != nil
+		unchanged := loaded && bytes.Equal(script, r.script)
+		r.vmLock.Unlock()
+		if loaded && !r.isRemotePAC() && modTime.Equal(r.modTime) {
+			return false, nil
+		}
+		if unchanged {
+			r.modTime = modTime
+			return false, nil
+		}
+		if err = r.compile(script); err == nil {
+			r.modTime = modTime
+		}
+	}
+
+	r.vmLock.Lock()
+	r.loadErr = err
+	r.vmLock.Unlock()
+	return err == nil, err
+}
+
+// watch 定期检测 PAC 脚本是否变化，变化时重新加载，加载失败时继续重试
+func (r *pacResolver) watch(ctx context.Context) {
+	ticker := time.NewTicker(pacReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.cleanExpired()
+
+			reloaded, err := r.reload()
+			if err != nil {
+				log.Printf("Failed to reload pac script %s: %v", r.source, err)
+				continue
+			}
+			if reloaded {
+				log.Printf("PAC script reloaded from %s", r.source)
+			}
+		}
+	}
+}
+
+// Close 停止变更检测
+func (r *pacResolver) Close() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+func (r *pacResolver) cleanExpired() {
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+
+	now := time.Now()
+	for key, entry := range r.cache {
+		if now.After(entry.expiresAt) {
+			delete(r.cache, key)
+		}
+	}
+}
+
+// FindProxy 返回请求应使用的上游代理，nil 表示直连
+func (r *pacResolver) FindProxy(req *http.Request) (*url.URL, error) {
+	host := req.URL.Hostname()
+	// 按完整 URL 缓存，PAC 可能根据路径选择代理
+	key := req.URL.String()
+
+	r.cacheLock.RLock()
+	entry, ok := r.cache[key]
+	r.cacheLock.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.proxyURL, nil
+	}
+
+	r.vmLock.Lock()
+	vms, script, loadErr := r.vms, r.script, r.loadErr
+	r.vmLock.Unlock()
+	if vms == nil {
+		return nil, fmt.Errorf("pac script %s is not loaded: %w", r.source, loadErr)
+	}
+
+	var v *pacVM
+	select {
+	case v = <-vms:
+	default:
+		// 所有运行时都在使用中，创建新的运行时
+		var err error
+		if v, err = newPACVM(r.source, script); err != nil {
+			return nil, err
+		}
+	}
+
+	// 超时中断脚本，中断后运行时仍可继续使用
+	timer := time.AfterFunc(pacEvalTimeout, func() { v.vm.Interrupt("timeout") })
+	result, err := v.find(goja.Undefined(), v.vm.ToValue(req.URL.String()), v.vm.ToValue(host))
+	timer.Stop()
+	v.vm.ClearInterrupt()
+	select {
+	case vms <- v:
+	default:
+	}
+	if err != nil {
+		return nil, fmt.Errorf("FindProxyForURL failed for %s: %w", key, err)
+	}
+
+	proxyURL, err := parsePACResult(result.String())
+	if err != nil {
+		return nil, err
+	}
+
+	r.cacheLock.Lock()
+	if len(r.cache) >= pacMaxCacheSize {
+		r.cache = make(map[string]*pacCacheEntry)
+	}
+	r.cache[key] = &pacCacheEntry{
+		proxyURL:  proxyURL,
+		expiresAt: time.Now().Add(pacCacheTTL),
+	}
+	r.cacheLock.Unlock()
+
+	return proxyURL, nil
+}
+
+// parsePACResult 解析 FindProxyForURL 的返回值，例如 "PROXY a:8080; SOCKS b:1080; DIRECT"
+// 取第一个可用的条目
+func parsePACResult(result string) (*url.URL, error) {
+	for _, item := range strings.Split(result, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var scheme string
+		switch strings.ToUpper(fields[0]) {
+		case "DIRECT":
+			return nil, nil
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			log.Printf("Unsupported pac proxy type: %s", fields[0])
+			continue
+		}
+
+		if len(fields) < 2 {
+			continue
+		}
+		return url.Parse(scheme + "://" + fields[1])
+	}
+
+	if strings.TrimSpace(result) == "" {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("no usable proxy in pac result: %s", result)
+}
+
+func pacDNSResolve(host string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), pacDNSTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return ""
+	}
+	for _, ip := range ips {
+		if ip4 := ip.IP.To4(); ip4 != nil {
+			return ip4.String()
+		}
+	}
+	return ""
+}
+
+func pacMyIPAddress() string {
+	// 通过 UDP "连接" 获取出口网卡地址，不会真正发送数据
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err == nil {
+		defer conn.Close()
+		if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+			return addr.IP.String()
+		}
+	}
+	return "127.0.0.1"
+}
@@ -4,9 +4,7 @@ import (
 	"bufio"
 	"compress/flate"
 	"compress/gzip"
-	"context"
 	"crypto/tls"
-	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,7 +14,6 @@ import (
 	"proxyMan/server/cert"
 	"proxyMan/server/common"
 	"sync"
-	"time"
 
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
@@ -38,16 +35,27 @@ func (b bufferedConn) Read(p []byte) (int, error) {
 
 // HandleHTTP is the main handler for all incoming proxy requests.
 func HandleHTTP(w http.ResponseWriter, r *http.Request) {
+	listener := listenerFromContext(r.Context())
+
+	// CONNECT 也在 Hijack 之前质询，客户端会带上凭据重新发起
+	if reason := checkProxyAuthorization(r.Header.Get("Proxy-Authorization")); reason != "" {
+		recordRejected(r.RemoteAddr, listener, reason, r.Host)
+		writeProxyAuthRequired(w)
+		return
+	}
+	// 凭据只用于本代理，不转发给目标服务器，也不出现在抓包记录中
+	r.Header.Del("Proxy-Authorization")
+
 	if r.Method == http.MethodConnect {
-		handleConnect(w, r)
+		handleConnect(w, r, listener)
 	} else {
-		handlePlainHTTP(w, r)
+		handlePlainHTTP(w, r, listener)
 	}
 }
 
-func handlePlainHTTP(w io.Writer, r *http.Request) {
+func handlePlainHTTP(w io.Writer, r *http.Request, listener string) {
 	// 创建DataProxy实例来跟踪这个请求
-	proxy := NewDataProxy()
+	proxy := NewDataProxy(listener)
 	// 报告请求信息
 	proxy.reportRequest(r)
 
@@ -64,11 +72,7 @@ func handlePlainHTTP(w io.Writer, r *http.Request) {
 	r.URL.Host = r.Host
 
 	// 转发请求到目标服务器
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: buildProxyFunc(),
-		},
-	}
+	client := &http.Client{Transport: upstreamTransport()}
 
 	targetResp, err := client.Do(r)
 	if err != nil {
@@ -103,7 +107,7 @@ func handlePlainHTTP(w io.Writer, r *http.Request) {
 }
 
 // handleConnect handles HTTPS CONNECT requests for MITM.
-func handleConnect(w http.ResponseWriter, r *http.Request) {
+func handleConnect(w http.ResponseWriter, r *http.Request, listener string) {
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
 		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
@@ -115,46 +119,66 @@ func handleConnect(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
+	markHijacked(clientConn)
 
 	_, err = clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
 	if err != nil {
 		log.Printf("Failed to write connectied status for %s: %s", r.Host, err)
+		_ = clientConn.Close()
 		return
 	}
 
+	handleTunnel(clientConn, r.Host, listener)
+}
+
+// handleTunnel 处理已建立的隧道连接（CONNECT、SOCKS 等），
+// 通过窥探首字节区分明文 HTTP 和 TLS，TLS 流量进行 MITM。
+// host 为客户端请求的目标地址，SNI 缺失时用于签发证书；listener 为接收该连接的监听名称。
+func handleTunnel(clientConn net.Conn, host string, listener string) {
+	defer clientConn.Close()
+
 	bufReader := bufio.NewReader(clientConn)
 	// 窥探第一个字节来判断协议
 	firstByte, err := bufReader.Peek(1)
 	if err != nil {
-		log.Printf("Failed to peek first byte from %s: %s", r.Host, err)
+		log.Printf("Failed to peek first byte from %s: %s", host, err)
 		return
 	}
 
 	// TLS Handshake record type in decimal is 22
 	if firstByte[0] != 0x16 {
 		// --- 是普通HTTP流量，建立TCP隧道 ---
-		log.Printf("Protocol Sniffing: Detected HTTP for %s", r.Host)
+		log.Printf("Protocol Sniffing: Detected HTTP for %s", host)
 		clientReq, err := http.ReadRequest(bufReader)
 		if err != nil {
-			log.Printf("Failed to read HTTP request from %s: %s", r.Host, err)
+			log.Printf("Failed to read HTTP request from %s: %s", host, err)
 			return
 		}
-		handlePlainHTTP(clientConn, clientReq)
+		if clientReq.Host == "" {
+			clientReq.Host = host
+		}
+		handlePlainHTTP(clientConn, clientReq, listener)
 		return
 	}
 
 	// --- 是TLS流量，处理HTTPS ---
 
-	tlsCert, err := cert.GetCertificate(r.Host)
-	if err != nil {
-		log.Printf("Failed to get certificate for %s: %s", r.Host, err)
-		_ = clientConn.Close()
-		return
-	}
-
-	tlsConn := tls.Server(bufferedConn{r: bufReader, Conn: clientConn}, &tls.Config{Certificates: []tls.Certificate{*tlsCert}})
+	tlsConn := tls.Server(bufferedConn{r: bufReader, Conn: clientConn}, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// 优先使用 SNI，客户端直接连接 IP 时（如 SOCKS）才回退到目标地址
+			serverName := hello.ServerName
+			if serverName == "" {
+				serverName = host
+			}
+			tlsCert, err := cert.GetCertificate(serverName)
+			if err != nil {
+				log.Printf("Failed to get certificate for %s: %s", serverName, err)
+			}
+			return tlsCert, err
+		},
+	})
 	if err := tlsConn.Handshake(); err != nil {
-		log.Printf("TLS handshake error with %s: %s", r.Host, err)
+		log.Printf("TLS handshake error with %s: %s", host, err)
 		_ = tlsConn.Close()
 		return
 	}
@@ -165,8 +189,11 @@ func handleConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer clientReq.Body.Close()
+	if clientReq.Host == "" {
+		clientReq.Host = host
+	}
 
-	proxy := NewDataProxy()
+	proxy := NewDataProxy(listener)
 	proxy.reportRequest(clientReq)
 
 	//代理请求流
@@ -181,11 +208,7 @@ func handleConnect(w http.ResponseWriter, r *http.Request) {
 	clientReq.URL.Scheme = "https"
 	clientReq.URL.Host = clientReq.Host
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: buildProxyFunc(),
-		},
-	}
+	client := &http.Client{Transport: upstreamTransport()}
 
 	targetResp, err := client.Do(clientReq)
 	if err != nil {
@@ -296,12 +319,6 @@ func copyStream(src io.Reader, dst io.Writer, proxy *DataProxy, dataType common.
 }
 
 var (
-	currentServer *http.Server
-	serverMutex   sync.Mutex
-	startError    error
-	currentHost   = "127.0.0.1" // 默认监听地址
-	currentPort   = 8888        // 默认端口
-
 	upstreamProxyConfig     common.UpstreamProxyConfig
 	upstreamProxyConfigLock sync.RWMutex
 )
@@ -310,46 +327,11 @@ func init() {
 	upstreamProxyConfig = common.GetConfig().UpstreamProxy
 }
 
-func StartProxy(host string, port int) error {
-	serverMutex.Lock()
-	defer serverMutex.Unlock()
-
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
-	if err != nil {
-		log.Printf("Failed to bind address : %s cause %v", fmt.Sprintf("%s:%d", host, port), err)
-		return err
-	}
-
-	if currentServer != nil {
-		_ = listener.Close()
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := currentServer.Shutdown(ctx); err != nil {
-			log.Printf("Failed to shutdown proxy server: %v", err)
-			return err
-		}
-		currentServer = nil
-		log.Println("Proxy server stopped")
-	}
-
-	currentServer = &http.Server{Handler: http.HandlerFunc(HandleHTTP)}
-	// 保存当前配置
-	startError = nil
-	currentHost = host
-	currentPort = port
-	go doStartServer(currentServer, listener)
-
-	return nil
-}
-
-func doStartServer(server *http.Server, listener net.Listener) {
-	log.Println("Starting Proxy Server on " + listener.Addr().String())
-	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Println("Failed to listenAndServe: ", err)
-		serverMutex.Lock()
-		defer serverMutex.Unlock()
-		currentServer = nil
-		startError = err
+// InitUpstreamProxy 服务启动时加载配置中的 PAC 脚本，子命令不需要调用
+func InitUpstreamProxy() {
+	cfg := GetUpstreamProxyConfig()
+	if cfg.Mode == "pac" {
+		startPACSource(cfg.PacURL)
 	}
 }
 
@@ -363,16 +345,36 @@ func SetUpstreamProxyConfig(cfg common.UpstreamProxyConfig) error {
 	upstreamProxyConfigLock.Lock()
 	defer upstreamProxyConfigLock.Unlock()
 
-	// 持久化配置
-	err := common.UpdateUpstreamProxyConfig(cfg)
+	// PAC 模式先加载脚本，加载失败则不保存配置
+	pacSource := ""
+	if cfg.Mode == "pac" {
+		pacSource = cfg.PacURL
+	}
+	resolver, changed, err := loadPACSource(pacSource)
 	if err != nil {
 		return err
 	}
 
+	// 持久化配置，成功后再切换，保证运行状态与保存的配置一致
+	if err := common.UpdateUpstreamProxyConfig(cfg); err != nil {
+		if resolver != nil {
+			resolver.Close()
+		}
+		return err
+	}
+
+	if changed {
+		swapPACSource(resolver)
+	}
 	upstreamProxyConfig = cfg
 	return nil
 }
 
+// upstreamTransport 转发请求使用的 Transport，按当前配置经过上游代理
+func upstreamTransport() *http.Transport {
+	return &http.Transport{Proxy: buildProxyFunc()}
+}
+
 func buildProxyFunc() func(*http.Request) (*url.URL, error) {
 	cfg := GetUpstreamProxyConfig()
 
@@ -402,22 +404,18 @@ func buildProxyFunc() func(*http.Request) (*url.URL, error) {
 		return http.ProxyURL(proxyURL)
 	}
 
+	// Mode: "pac" - 使用 PAC 脚本
+	if cfg.Mode == "pac" {
+		resolver := getPACResolver()
+		if resolver == nil {
+			log.Printf("pac script %s is not loaded, fallback to direct", cfg.PacURL)
+			return func(*http.Request) (*url.URL, error) {
+				return nil, nil
+			}
+		}
+		return resolver.FindProxy
+	}
+
 	// 默认使用环境变量
 	return http.ProxyFromEnvironment
 }
-
-func IsStarted() (bool, error) {
-	return currentServer != nil, startError
-}
-
-func GetCurrentProxyPort() int {
-	serverMutex.Lock()
-	defer serverMutex.Unlock()
-	return currentPort
-}
-
-func GetCurrentProxyHost() string {
-	serverMutex.Lock()
-	defer serverMutex.Unlock()
-	return currentHost
-}
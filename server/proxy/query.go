@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"cmp"
+	"proxyMan/server/common"
+	"proxyMan/server/storage"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RequestQuery 请求列表的查询条件，零值表示不过滤
+type RequestQuery struct {
+	Host        string // 匹配该域名及其子域名，或匹配通配符（例如 *.example.com），规则同 common.MatchHost
+	Method      string
+	StatusMin   int
+	StatusMax   int
+	ContentType string // 包含该字符串
+	From        time.Time
+	To          time.Time
+	Search      string // URL 包含该字符串
+	Tag         string
+	Session     string // 会话名称
+	ReplayOf    int64  // 重放的原请求 ID
+	Sort        string // id、time、duration、status、method、host、url，默认 id
+	Asc         bool   // 默认从新到旧
+	Offset      int
+	Limit       int
+}
+
+// RequestPage 一页查询结果。按 ID 排序时填满一页就停止查找，Total 为 -1，More 表示之后还有匹配的请求
+type RequestPage struct {
+	Total  int                     `json:"total"`
+	More   bool                    `json:"more"`
+	Offset int                     `json:"offset"`
+	Limit  int                     `json:"limit"`
+	Items  []common.RequestSummary `json:"items"`
+}
+
+// ListRequests 查询内存缓存和持久化存储中的请求，同一请求以内存中的状态为准
+func ListRequests(q RequestQuery) RequestPage {
+	storageMutex.RLock()
+	s := store
+	storageMutex.RUnlock()
+
+	if q.Sort == "" || q.Sort == "id" {
+		return listRequestsByID(q, s)
+	}
+
+	seen := make(map[int64]bool)
+	var items []common.RequestSummary
+	for _, summary := range cachedSummaries() {
+		seen[summary.ID] = true
+		if q.match(summary) {
+			items = append(items, summary)
+		}
+	}
+	if s != nil {
+		s.Range(func(summary common.RequestSummary) bool {
+			if !seen[summary.ID] && q.match(summary) {
+				items = append(items, summary)
+			}
+			return true
+		})
+	}
+
+	sortSummaries(items, q.Sort, q.Asc)
+
+	page := RequestPage{Total: len(items), Offset: q.Offset, Limit: q.Limit, Items: []common.RequestSummary{}}
+	if q.Offset < len(items) {
+		end := len(items)
+		if q.Limit > 0 {
+			end = min(end, q.Offset+q.Limit)
+		}
+		page.Items = items[q.Offset:end]
+	}
+	return page
+}
+
+// listRequestsByID 按 ID 顺序合并内存缓存和持久化存储的索引，跳过 offset 之前的请求，
+// 找到一页之后的下一个匹配请求时停止，不需要遍历和排序所有记录
+func listRequestsByID(q RequestQuery, s storage.Store) RequestPage {
+	cached := cachedSummaries()
+	seen := make(map[int64]bool, len(cached))
+	for _, summary := range cached {
+		seen[summary.ID] = true
+	}
+	slices.SortFunc(cached, func(a, b common.RequestSummary) int {
+		if q.Asc {
+			return cmp.Compare(a.ID, b.ID)
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	page := RequestPage{Offset: q.Offset, Limit: q.Limit, Items: []common.RequestSummary{}}
+	matched := 0
+	// visit 处理下一个请求，页面已满且还有匹配的请求时返回 false
+	visit := func(summary common.RequestSummary) bool {
+		if !q.match(summary) {
+			return true
+		}
+		if q.Limit > 0 && len(page.Items) == q.Limit {
+			page.More = true
+			return false
+		}
+		if matched >= q.Offset {
+			page.Items = append(page.Items, summary)
+		}
+		matched++
+		return true
+	}
+
+	next := 0
+	if s != nil {
+		s.RangeByID(!q.Asc, func(summary common.RequestSummary) bool {
+			for ; next < len(cached) && (cached[next].ID < summary.ID) == q.Asc && cached[next].ID != summary.ID; next++ {
+				if !visit(cached[next]) {
+					return false
+				}
+			}
+			return seen[summary.ID] || visit(summary)
+		})
+	}
+	for ; !page.More && next < len(cached); next++ {
+		visit(cached[next])
+	}
+
+	page.Total = matched
+	if page.More {
+		page.Total = -1
+	}
+	return page
+}
+
+// cachedSummaries 返回内存缓存中所有请求的摘要
+func cachedSummaries() []common.RequestSummary {
+	cacheMutex.Lock()
+	proxies := make([]*DataProxy, 0, len(cacheEntries))
+	for e := cacheOrder.Front(); e != nil; e = e.Next() {
+		proxies = append(proxies, e.Value.(*cacheEntry).proxy)
+	}
+	cacheMutex.Unlock()
+
+	summaries := make([]common.RequestSummary, 0, len(proxies))
+	for _, p := range proxies {
+		p.lock.Lock()
+		summaries = append(summaries, p.Contents.RequestSummary)
+		p.lock.Unlock()
+	}
+	return summaries
+}
+
+func (q RequestQuery) match(s common.RequestSummary) bool {
+	if q.Host != "" && !common.MatchHost(q.Host, s.Host) {
+		return false
+	}
+	if q.Method != "" && !strings.EqualFold(s.Method, q.Method) {
+		return false
+	}
+	if q.StatusMin > 0 && s.StatusCode < q.StatusMin {
+		return false
+	}
+	if q.StatusMax > 0 && s.StatusCode > q.StatusMax {
+		return false
+	}
+	if q.ContentType != "" && !strings.Contains(strings.ToLower(s.ContentType), strings.ToLower(q.ContentType)) {
+		return false
+	}
+	if s.StartTime != nil {
+		if !q.From.IsZero() && s.StartTime.Before(q.From) {
+			return false
+		}
+		if !q.To.IsZero() && s.StartTime.After(q.To) {
+			return false
+		}
+	}
+	if q.Search != "" && !strings.Contains(strings.ToLower(s.URL), strings.ToLower(q.Search)) {
+		return false
+	}
+	if q.Tag != "" && !hasTag(s.Tags, q.Tag) {
+		return false
+	}
+	if q.Session != "" && s.Session != q.Session {
+		return false
+	}
+	if q.ReplayOf != 0 && s.ReplayOf != q.ReplayOf {
+		return false
+	}
+	return true
+}
+
+// SummaryFilter 实时请求推送的订阅条件，零值表示不过滤，同一字段的多个值满足任意一个即可
+type SummaryFilter struct {
+	Hosts        []string `json:"hosts"` // 同 RequestQuery.Host
+	Methods      []string `json:"methods"`
+	StatusMin    int      `json:"statusMin"`
+	StatusMax    int      `json:"statusMax"`
+	ContentTypes []string `json:"contentTypes"` // 包含该字符串
+	Listeners    []string `json:"listeners"`
+	Tags         []string `json:"tags"`
+}
+
+// IsEmpty 判断是否没有任何条件
+func (f SummaryFilter) IsEmpty() bool {
+	return len(f.Hosts) == 0 && len(f.Methods) == 0 && f.StatusMin == 0 && f.StatusMax == 0 &&
+		len(f.ContentTypes) == 0 && len(f.Listeners) == 0 && len(f.Tags) == 0
+}
+
+func (f SummaryFilter) Match(s common.RequestSummary) bool {
+	anyOf := func(values []string, match func(string) bool) bool {
+		return len(values) == 0 || slices.ContainsFunc(values, match)
+	}
+
+	if !anyOf(f.Hosts, func(pattern string) bool { return common.MatchHost(pattern, s.Host) }) {
+		return false
+	}
+	if !anyOf(f.Methods, func(method string) bool { return strings.EqualFold(s.Method, method) }) {
+		return false
+	}
+	if f.StatusMin > 0 && s.StatusCode < f.StatusMin {
+		return false
+	}
+	if f.StatusMax > 0 && s.StatusCode > f.StatusMax {
+		return false
+	}
+	if !anyOf(f.ContentTypes, func(contentType string) bool {
+		return strings.Contains(strings.ToLower(s.ContentType), strings.ToLower(contentType))
+	}) {
+		return false
+	}
+	if !anyOf(f.Listeners, func(listener string) bool { return s.Listener == listener }) {
+		return false
+	}
+	return anyOf(f.Tags, func(tag string) bool { return hasTag(s.Tags, tag) })
+}
+
+func sortSummaries(items []common.RequestSummary, field string, asc bool) {
+	compare := func(a, b common.RequestSummary) int {
+		switch field {
+		case "time":
+			return compareTime(a.StartTime, b.StartTime)
+		case "duration":
+			return cmp.Compare(summaryDuration(a), summaryDuration(b))
+		case "status":
+			return cmp.Compare(a.StatusCode, b.StatusCode)
+		case "method":
+			return strings.Compare(a.Method, b.Method)
+		case "host":
+			return strings.Compare(a.Host, b.Host)
+		case "url":
+			return strings.Compare(a.URL, b.URL)
+		}
+		return 0
+	}
+
+	slices.SortStableFunc(items, func(a, b common.RequestSummary) int {
+		c := compare(a, b)
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if !asc {
+			c = -c
+		}
+		return c
+	})
+}
+
+func summaryDuration(s common.RequestSummary) time.Duration {
+	if s.StartTime == nil {
+		return 0
+	}
+	if s.EndTime == nil {
+		return time.Since(*s.StartTime)
+	}
+	return s.EndTime.Sub(*s.StartTime)
+}
+
+func compareTime(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.Compare(*b)
+}
+
+// SummariesSince 返回内存缓存中 ID 大于 since 的请求以及所有未结束的请求，按 ID 从旧到新排列
+func SummariesSince(since int64) []common.RequestSummary {
+	summaries := []common.RequestSummary{}
+	for _, summary := range cachedSummaries() {
+		finished := summary.Status == common.StatusCompleted || summary.Status == common.StatusError
+		if summary.ID > since || !finished {
+			summaries = append(summaries, summary)
+		}
+	}
+	slices.SortFunc(summaries, func(a, b common.RequestSummary) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return summaries
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"proxyMan/server/common"
+	"slices"
+	"sync"
+)
+
+// ReplayListener 重放请求记录的监听名称
+const ReplayListener = "replay"
+
+// 单次重放的次数和并发数上限
+const (
+	maxReplayRepeat      = 100
+	maxReplayConcurrency = 10
+)
+
+// ReplayOptions 重放参数，零值表示按原样重放一次
+type ReplayOptions struct {
+	Headers     map[string]string // 覆盖的 header，值为空时删除该 header
+	Body        []byte            // 覆盖的请求 body，nil 表示使用原请求的 body
+	Repeat      int               // 重放次数，默认 1
+	Concurrency int               // 同时发送的请求数，默认 1
+}
+
+// Replay 按原请求的方法、URL、header 和 body 经上游代理重新发送请求，每次重放记录为关联原请求的新请求。
+// 原请求的 body 还在接收时先等待其结束；等待所有重放结束后返回，ctx 取消时不再发送剩余的请求
+func (p *DataProxy) Replay(ctx context.Context, opts ReplayOptions) ([]SendResult, error) {
+	if opts.Repeat == 0 {
+		opts.Repeat = 1
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Repeat < 1 || opts.Repeat > maxReplayRepeat {
+		return nil, fmt.Errorf("repeat must be between 1 and %d", maxReplayRepeat)
+	}
+	if opts.Concurrency < 1 || opts.Concurrency > maxReplayConcurrency {
+		return nil, fmt.Errorf("concurrency must be between 1 and %d", maxReplayConcurrency)
+	}
+
+	if err := p.waitStatusChange(ctx, common.RequestBody); err != nil {
+		return nil, err
+	}
+	template, err := newReplayTemplate(p.Snapshot(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一批重放共用连接，与原请求不同，不自动跟随重定向
+	client := &http.Client{Transport: upstreamTransport(), CheckRedirect: noRedirect}
+	defer client.CloseIdleConnections()
+
+	results := make([]SendResult, 0, opts.Repeat)
+	var resultsLock sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, opts.Concurrency)
+send:
+	for range opts.Repeat {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			break send
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := template.send(ctx, client)
+			resultsLock.Lock()
+			results = append(results, result)
+			resultsLock.Unlock()
+			<-slots
+		}()
+	}
+	wg.Wait()
+
+	slices.SortFunc(results, func(a, b SendResult) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return results, nil
+}
+
+// newReplayTemplate 由原请求生成重放的请求。记录的请求 body 已解码，因此不保留 Content-Encoding
+func newReplayTemplate(c *common.HttpContents, opts ReplayOptions) (*outgoingRequest, error) {
+	header := c.RequestHeaders.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	body := opts.Body
+	if body == nil {
+		body = c.RequestBody
+		// 请求 body 超过记录上限或请求中途出错时，只记录了前面的部分
+		if reason := c.IncompleteRequestBody(); reason != "" {
+			return nil, fmt.Errorf("body of request %d was not fully recorded (%s), override the body to replay it", c.ID, reason)
+		}
+	}
+
+	header.Del("Content-Encoding")
+	for name, value := range opts.Headers {
+		if value == "" {
+			header.Del(name)
+		} else {
+			header.Set(name, value)
+		}
+	}
+	cleanHeader(header)
+
+	if _, err := http.NewRequest(c.Method, c.URL, nil); err != nil {
+		return nil, fmt.Errorf("request %d cannot be replayed: %w", c.ID, err)
+	}
+	return &outgoingRequest{
+		method:   c.Method,
+		url:      c.URL,
+		header:   header,
+		body:     body,
+		listener: ReplayListener,
+		replayOf: c.ID,
+	}, nil
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"proxyMan/server/cert"
+	"proxyMan/server/common"
+	"strings"
+)
+
+// hopHeaders 逐跳头，反向代理转发时不应透传
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// reverseHandler 将请求转发到固定后端的反向代理
+type reverseHandler struct {
+	name   string
+	target *url.URL
+	client *http.Client
+}
+
+func newReverseHandler(cfg common.ListenerConfig) (*reverseHandler, error) {
+	target, err := url.Parse(cfg.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %s: %w", cfg.Target, err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid target %s: must be http(s)://host[:port]", cfg.Target)
+	}
+
+	return &reverseHandler{
+		name:   cfg.Name,
+		target: target,
+		// 后端固定，不经过上游代理，也不自动跟随重定向
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: nil},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// tlsListener 使用 CA 签发的证书终止 TLS，SNI 缺失时使用监听地址
+func tlsListener(listener net.Listener, host string) net.Listener {
+	return tls.NewListener(listener, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			serverName := hello.ServerName
+			if serverName == "" {
+				serverName = host
+			}
+			if serverName == "" || serverName == "0.0.0.0" || serverName == "::" {
+				serverName = "localhost"
+			}
+			return cert.GetCertificate(serverName)
+		},
+	})
+}
+
+// ServeHTTP 将请求改写到后端并记录完整的请求/响应
+func (rs *reverseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	outReq.URL.Scheme = rs.target.Scheme
+	outReq.URL.Host = rs.target.Host
+	outReq.URL.Path = joinURLPath(rs.target.Path, r.URL.Path)
+	outReq.URL.RawPath = ""
+	if rs.target.RawQuery != "" && r.URL.RawQuery != "" {
+		outReq.URL.RawQuery = rs.target.RawQuery + "&" + r.URL.RawQuery
+	} else if rs.target.RawQuery != "" {
+		outReq.URL.RawQuery = rs.target.RawQuery
+	}
+	outReq.Host = rs.target.Host
+
+	for _, h := range hopHeaders {
+		outReq.Header.Del(h)
+	}
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := outReq.Header.Get("X-Forwarded-For"); prior != "" {
+			clientIP = prior + ", " + clientIP
+		}
+		outReq.Header.Set("X-Forwarded-For", clientIP)
+	}
+	outReq.Header.Set("X-Forwarded-Host", r.Host)
+	if r.TLS != nil {
+		outReq.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		outReq.Header.Set("X-Forwarded-Proto", "http")
+	}
+
+	proxy := NewDataProxy(rs.name)
+	proxy.reportRequest(outReq)
+
+	// 代理请求流
+	pr, pw := io.Pipe()
+	bodyReader := r.Body
+	outReq.Body = pr
+	go copyStream(bodyReader, pw, proxy, common.RequestBody, r.Header)
+
+	targetResp, err := rs.client.Do(outReq)
+	if err != nil {
+		proxy.reportError(err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer targetResp.Body.Close()
+	proxy.reportResponse(targetResp)
+
+	respHeader := targetResp.Header.Clone()
+	for _, h := range hopHeaders {
+		respHeader.Del(h)
+	}
+	for key, values := range respHeader {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(targetResp.StatusCode)
+
+	// 代理响应，逐块 flush 以支持 SSE 等流式响应
+	copyStream(targetResp.Body, flushWriter{w}, proxy, common.ResponseBody, targetResp.Header)
+
+	log.Printf("Completed reverse request: (ID: %d, Duration: %dms)", proxy.Id(), proxy.Duration())
+}
+
+// flushWriter 每次写入后立即 flush
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+func joinURLPath(base, path string) string {
+	if base == "" {
+		return path
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
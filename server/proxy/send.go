@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"proxyMan/server/common"
+	"sync"
+)
+
+// SendResult 一次主动发送（重放、构造请求）的结果
+type SendResult struct {
+	ID         int64  `json:"id"`
+	StatusCode int    `json:"statusCode"`
+	Proto      string `json:"proto,omitempty"`    // 响应的协议版本，例如 HTTP/2.0
+	FinalURL   string `json:"finalUrl,omitempty"` // 跟随重定向后的地址，没有重定向时为空
+	Duration   int64  `json:"duration"`           // 毫秒
+	Error      string `json:"error,omitempty"`
+}
+
+// outgoingRequest ProxyMan 主动发送的请求，每次发送复制一份，记录为 listener 下的新请求
+type outgoingRequest struct {
+	method   string
+	url      string
+	header   http.Header // Host 用于覆盖请求的 Host
+	body     []byte
+	listener string
+	replayOf int64 // 重放的原请求 ID
+}
+
+// cleanHeader 删除逐跳头，Content-Length 按 body 重新计算
+func cleanHeader(header http.Header) {
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+	header.Del("Content-Length")
+}
+
+// noRedirect 不自动跟随重定向，返回重定向响应本身
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// send 发送请求并像代理的请求一样记录，等待响应 body 接收完成
+func (o *outgoingRequest) send(ctx context.Context, client *http.Client) SendResult {
+	proxy := NewDataProxy(o.listener)
+	proxy.lock.Lock()
+	proxy.Contents.ReplayOf = o.replayOf
+	proxy.lock.Unlock()
+
+	// 请求写完时记录请求 body 结束，连接复用失败重试时只记录一次
+	var sent sync.Once
+	reportSent := func() {
+		sent.Do(func() { proxy.reportEnd(common.RequestBody) })
+	}
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) { reportSent() },
+	}
+
+	result := SendResult{}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), o.method, o.url, bytes.NewReader(o.body))
+	if err == nil {
+		req.Header = o.header.Clone()
+		if host := req.Header.Get("Host"); host != "" {
+			req.Host = host
+			req.Header.Del("Host")
+		}
+		// 记录实际连接的地址，覆盖的 Host 保留在 header 中，重放时仍然有效
+		recorded := *req
+		recorded.Host = req.URL.Host
+		recorded.Header = o.header.Clone()
+		proxy.reportRequest(&recorded)
+		if len(o.body) > 0 {
+			proxy.reportChunkData(common.RequestBody, o.body)
+		}
+
+		var resp *http.Response
+		if resp, err = client.Do(req); err == nil {
+			reportSent()
+			proxy.reportResponse(resp)
+			result.Proto = resp.Proto
+			if finalURL := resp.Request.URL.String(); finalURL != o.url {
+				result.FinalURL = finalURL
+			}
+
+			body := &readErrorRecorder{Reader: resp.Body}
+			copyStream(body, io.Discard, proxy, common.ResponseBody, resp.Header)
+			_ = resp.Body.Close()
+			// 响应 body 由 copyStream 异步记录，读取中断（例如 ctx 取消）时记录结束后再标记为出错
+			_ = proxy.waitStatusChange(context.Background(), common.ResponseBody)
+			err = body.err
+		}
+	}
+	if err != nil {
+		proxy.reportError(err)
+	}
+
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	if o.replayOf != 0 {
+		log.Printf("Replayed request %d as %d: %s %s", o.replayOf, proxy.Id(), o.method, o.url)
+	} else {
+		log.Printf("Sent %s request %d: %s %s", o.listener, proxy.Id(), o.method, o.url)
+	}
+	result.ID = proxy.Id()
+	result.StatusCode = proxy.Contents.StatusCode
+	result.Duration = proxy.Contents.EndTime.Sub(*proxy.Contents.StartTime).Milliseconds()
+	result.Error = proxy.Contents.Error
+	return result
+}
+
+// readErrorRecorder 记录读取时遇到的错误，copyStream 会把读取错误当作 body 结束
+type readErrorRecorder struct {
+	io.Reader
+	err error
+}
+
+func (r *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
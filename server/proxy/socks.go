@@ -0,0 +1,282 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	socks4Version = 0x04
+	socks5Version = 0x05
+
+	socksCmdConnect = 0x01
+
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xFF
+
+	// RFC 1929 用户名/密码认证子协商
+	socks5AuthPasswordVersion = 0x01
+	socks5AuthPasswordSuccess = 0x00
+	socks5AuthPasswordFailure = 0x01
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5RepSucceeded           = 0x00
+	socks5RepCmdNotSupported     = 0x07
+	socks5RepAddrTypeUnsupported = 0x08
+
+	socks4RepGranted  = 0x5A
+	socks4RepRejected = 0x5B
+
+	socksHandshakeTimeout = 30 * time.Second
+)
+
+// serveSocks 接受 SOCKS 连接，listener 关闭时返回
+func serveSocks(listener net.Listener, name string) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go handleSocksConn(conn, name)
+	}
+}
+
+// handleSocksConn 完成 SOCKS 握手后交给与 CONNECT 相同的隧道处理流程
+func handleSocksConn(conn net.Conn, name string) {
+	_ = conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	bufReader := bufio.NewReader(conn)
+
+	version, err := bufReader.ReadByte()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	var target string
+	switch version {
+	case socks5Version:
+		target, err = socks5Handshake(bufReader, conn)
+	case socks4Version:
+		target, err = socks4Handshake(bufReader, conn)
+	default:
+		err = fmt.Errorf("unsupported socks version %d", version)
+	}
+	if err != nil {
+		var authErr socksAuthError
+		if errors.As(err, &authErr) {
+			recordRejected(conn.RemoteAddr().String(), name, string(authErr), target)
+		} else {
+			log.Printf("Socks handshake failed from %s: %v", conn.RemoteAddr(), err)
+		}
+		_ = conn.Close()
+		return
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	log.Printf("Socks tunnel established: %s -> %s", conn.RemoteAddr(), target)
+	handleTunnel(bufferedConn{r: bufReader, Conn: conn}, target, name)
+}
+
+// socksAuthError 代理认证失败，记录到拒绝列表
+type socksAuthError string
+
+func (e socksAuthError) Error() string {
+	return string(e)
+}
+
+// socks5Handshake 处理 SOCKS5 协商和 CONNECT 请求，返回目标地址
+func socks5Handshake(r *bufio.Reader, w io.Writer) (string, error) {
+	nMethods, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	methods := make([]byte, nMethods)
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", err
+	}
+
+	// 开启代理认证时只接受用户名/密码认证
+	wanted := byte(socks5AuthNone)
+	if proxyAuthRequired() {
+		wanted = socks5AuthPassword
+	}
+	method := byte(socks5AuthNoAcceptable)
+	for _, m := range methods {
+		if m == wanted {
+			method = wanted
+			break
+		}
+	}
+	if _, err := w.Write([]byte{socks5Version, method}); err != nil {
+		return "", err
+	}
+	if method == socks5AuthNoAcceptable {
+		if wanted == socks5AuthPassword {
+			return "", socksAuthError("missing credentials")
+		}
+		return "", errors.New("no acceptable auth method")
+	}
+	if method == socks5AuthPassword {
+		if err := socks5PasswordAuth(r, w); err != nil {
+			return "", err
+		}
+	}
+
+	// VER CMD RSV ATYP
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unexpected socks version %d", header[0])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5AtypIPv4:
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socks5AtypIPv6:
+		ip := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socks5AtypDomain:
+		length, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		domain := make([]byte, length)
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		_ = writeSocks5Reply(w, socks5RepAddrTypeUnsupported)
+		return "", fmt.Errorf("unsupported address type %d", header[3])
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(r, portBytes); err != nil {
+		return "", err
+	}
+	port := binary.BigEndian.Uint16(portBytes)
+
+	if header[1] != socksCmdConnect {
+		_ = writeSocks5Reply(w, socks5RepCmdNotSupported)
+		return "", fmt.Errorf("unsupported socks5 command %d", header[1])
+	}
+
+	if err := writeSocks5Reply(w, socks5RepSucceeded); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// socks5PasswordAuth 处理 RFC 1929 用户名/密码认证
+func socks5PasswordAuth(r *bufio.Reader, w io.Writer) error {
+	// VER ULEN UNAME PLEN PASSWD
+	version, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != socks5AuthPasswordVersion {
+		return fmt.Errorf("unsupported auth version %d", version)
+	}
+	username, err := readSocksString(r)
+	if err != nil {
+		return err
+	}
+	password, err := readSocksString(r)
+	if err != nil {
+		return err
+	}
+
+	if !checkCredentials(username, password) {
+		_, _ = w.Write([]byte{socks5AuthPasswordVersion, socks5AuthPasswordFailure})
+		return socksAuthError("invalid credentials")
+	}
+	_, err = w.Write([]byte{socks5AuthPasswordVersion, socks5AuthPasswordSuccess})
+	return err
+}
+
+// readSocksString 读取一个字节长度前缀的字符串
+func readSocksString(r *bufio.Reader) (string, error) {
+	length, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// writeSocks5Reply 写入 SOCKS5 响应，MITM 模式下不真正连接目标，绑定地址固定为 0.0.0.0:0
+func writeSocks5Reply(w io.Writer, rep byte) error {
+	_, err := w.Write([]byte{socks5Version, rep, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socks4Handshake 处理 SOCKS4/SOCKS4a CONNECT 请求，返回目标地址
+func socks4Handshake(r *bufio.Reader, w io.Writer) (string, error) {
+	// CD DSTPORT DSTIP
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	port := binary.BigEndian.Uint16(header[1:3])
+	ip := net.IP(header[3:7])
+
+	// USERID 以 NULL 结尾，忽略
+	if _, err := r.ReadBytes(0x00); err != nil {
+		return "", err
+	}
+
+	host := ip.String()
+	// SOCKS4a: DSTIP 为 0.0.0.x (x != 0) 时，域名跟在 USERID 之后
+	if ip[0] == 0 && ip[1] == 0 && ip[2] == 0 && ip[3] != 0 {
+		domain, err := r.ReadBytes(0x00)
+		if err != nil {
+			return "", err
+		}
+		host = string(domain[:len(domain)-1])
+	}
+
+	if header[0] != socksCmdConnect {
+		_ = writeSocks4Reply(w, socks4RepRejected)
+		return "", fmt.Errorf("unsupported socks4 command %d", header[0])
+	}
+
+	// SOCKS4 没有密码认证，开启代理认证时拒绝
+	if proxyAuthRequired() {
+		_ = writeSocks4Reply(w, socks4RepRejected)
+		return "", socksAuthError("socks4 does not support auth")
+	}
+
+	if err := writeSocks4Reply(w, socks4RepGranted); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+func writeSocks4Reply(w io.Writer, rep byte) error {
+	_, err := w.Write([]byte{0x00, rep, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"proxyMan/server/common"
+	"proxyMan/server/storage"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	store        storage.Store
+	storageDir   string
+	storageMutex sync.RWMutex
+)
+
+// InitStorage 根据配置打开持久化存储，失败时只保留内存缓存
+func InitStorage(cfg common.StorageConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	if err := openStorage(cfg); err != nil {
+		log.Printf("Failed to open capture storage, history will not be persisted: %v", err)
+	}
+}
+
+// openStorage 打开存储并让新请求的 ID 接着已保存的最大 ID 继续
+func openStorage(cfg common.StorageConfig) error {
+	s, err := storage.OpenDiskStore(cfg.StorageDir(), retentionOf(cfg))
+	if err != nil {
+		return err
+	}
+
+	storageMutex.Lock()
+	store = s
+	storageDir = cfg.StorageDir()
+	storageMutex.Unlock()
+
+	for {
+		current := atomic.LoadInt64(&maxIndex)
+		if current >= s.MaxID() || atomic.CompareAndSwapInt64(&maxIndex, current, s.MaxID()) {
+			break
+		}
+	}
+	return nil
+}
+
+func retentionOf(cfg common.StorageConfig) storage.Retention {
+	return storage.Retention{
+		MaxCount: cfg.MaxCount,
+		MaxAge:   time.Duration(cfg.MaxAgeHours) * time.Hour,
+		MaxBytes: int64(cfg.MaxSizeMB) * 1024 * 1024,
+	}
+}
+
+// SetStorageConfig 校验并持久化存储配置，立即开启、关闭或应用新的保留策略
+func SetStorageConfig(cfg common.StorageConfig) error {
+	if cfg.MaxCount < 0 || cfg.MaxAgeHours < 0 || cfg.MaxSizeMB < 0 {
+		return fmt.Errorf("retention limits must not be negative")
+	}
+
+	storageMutex.Lock()
+	current, currentDir := store, storageDir
+	if current != nil && (!cfg.Enabled || currentDir != cfg.StorageDir()) {
+		store = nil
+		storageDir = ""
+		current.Close()
+		current = nil
+	}
+	storageMutex.Unlock()
+
+	if current != nil {
+		current.SetRetention(retentionOf(cfg))
+	} else if cfg.Enabled {
+		if err := openStorage(cfg); err != nil {
+			return err
+		}
+	}
+
+	return common.UpdateStorageConfig(cfg)
+}
+
+// GetStorageStats 返回存储使用情况，未启用时返回 nil
+func GetStorageStats() *storage.Stats {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+	stats := store.Stats()
+	return &stats
+}
+
+// persistJob 一次待保存的请求，写入临时文件的 body 在保存时读取
+type persistJob struct {
+	store                             storage.Store
+	contents                          common.HttpContents
+	readRequestBody, readResponseBody func() []byte
+}
+
+var (
+	persistQueue   []persistJob
+	persistRunning bool
+	persistMutex   sync.Mutex
+)
+
+// persist 异步保存已结束的请求，已保存的请求会被覆盖，需要持有 p.lock。
+// 所有保存按调用顺序由同一个协程执行，同一请求的新记录不会被旧记录覆盖
+func (p *DataProxy) persist() {
+	storageMutex.RLock()
+	s := store
+	storageMutex.RUnlock()
+	if s == nil {
+		return
+	}
+
+	job := persistJob{store: s, contents: *p.Contents}
+	if p.reqBody != nil {
+		job.readRequestBody, job.readResponseBody = p.reqBody.snapshot(), p.respBody.snapshot()
+	}
+
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+	persistQueue = append(persistQueue, job)
+	if !persistRunning {
+		persistRunning = true
+		go persistLoop()
+	}
+}
+
+// persistLoop 依次保存队列中的请求，队列为空时退出
+func persistLoop() {
+	for {
+		persistMutex.Lock()
+		if len(persistQueue) == 0 {
+			persistRunning = false
+			persistMutex.Unlock()
+			return
+		}
+		job := persistQueue[0]
+		persistQueue[0] = persistJob{}
+		persistQueue = persistQueue[1:]
+		persistMutex.Unlock()
+
+		// 不占用请求的锁；从存储恢复的请求 body 在 Contents 中
+		if job.readRequestBody != nil {
+			job.contents.RequestBody = job.readRequestBody()
+			job.contents.ResponseBody = job.readResponseBody()
+		}
+		if err := job.store.Save(&job.contents); err != nil {
+			log.Printf("Failed to persist request %d: %v", job.contents.ID, err)
+		}
+	}
+}
+
+// loadProxy 从持久化存储中恢复已被内存缓存淘汰的请求
+func loadProxy(id int64) *DataProxy {
+	storageMutex.RLock()
+	s := store
+	storageMutex.RUnlock()
+	if s == nil {
+		return nil
+	}
+
+	contents, err := s.Load(id)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to load request %d from storage: %v", id, err)
+		}
+		return nil
+	}
+
+	return newStoredProxy(contents)
+}
+
+// newStoredProxy 用已结束的完整记录创建只读的请求，body 在 Contents 中
+func newStoredProxy(contents *common.HttpContents) *DataProxy {
+	data := &DataProxy{
+		Contents: contents,
+		Finished: true,
+		state:    common.ResponseBody,
+		lock:     &sync.Mutex{},
+	}
+	data.cond = sync.NewCond(data.lock)
+	if contents.Status == common.StatusError {
+		data.state = common.ERROR
+		data.error = errors.New(contents.Error)
+	}
+	return data
+}
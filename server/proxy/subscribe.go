@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"proxyMan/server/common"
+)
+
+// errBodyReleased 读取结束之前请求被移出内存缓存，需要重新打开请求
+var errBodyReleased = errors.New("body was released from memory before it was fully read, reload the request")
+
+// BodyCursor 从指定偏移量开始读取请求或响应 body，数据还未到达时等待，
+// 每个查看者使用独立的游标，互不影响。ctx 取消后 Next 立即返回 ctx.Err()。
+// body 写入临时文件后游标持有文件的引用，请求被移出内存缓存时仍能读完，用完后需要调用 Close
+type BodyCursor struct {
+	p        *DataProxy
+	ctx      context.Context
+	dataType common.DataType
+	offset   int64
+	limit    int64 // 不包含，-1 表示直到 body 结束
+	done     bool
+
+	view  bodyView // 最近一次取得的数据视图，只在持有 p.lock 时更新
+	ended bool     // view 已包含完整的 body
+}
+
+// Subscribe 创建读取 [start, end] 范围的游标，end 为 -1 时直到 body 结束
+func (p *DataProxy) Subscribe(ctx context.Context, dataType common.DataType, start, end int64) *BodyCursor {
+	limit := int64(-1)
+	if end >= 0 {
+		limit = end + 1
+	}
+	return &BodyCursor{p: p, ctx: ctx, dataType: dataType, offset: start, limit: limit}
+}
+
+// Offset 返回下一次读取的偏移量
+func (c *BodyCursor) Offset() int64 {
+	return c.offset
+}
+
+// Close 释放游标持有的文件引用，之后 Next 返回 nil, true, nil
+func (c *BodyCursor) Close() {
+	c.done = true
+	if c.view.file != nil {
+		c.view.file.close()
+		c.view.file = nil
+	}
+}
+
+// Next 返回下一段数据，finished 表示已读到范围末尾或 body 已结束（请求出错时也会结束）。
+// 读取文件时不持有请求的锁，不会阻塞代理转发。结束后继续调用返回 nil, true, nil
+func (c *BodyCursor) Next() (data []byte, finished bool, err error) {
+	if c.done {
+		return nil, true, nil
+	}
+	if c.limit >= 0 && c.offset >= c.limit {
+		c.Close()
+		return []byte{}, true, nil
+	}
+
+	view, ended, err := c.wait()
+	if err != nil {
+		return nil, false, err
+	}
+	if c.offset >= view.size {
+		// 已读取全部数据且 body 已结束（或出错），返回结束标记
+		c.Close()
+		return []byte{}, true, nil
+	}
+
+	size := int64(streamChunkSize)
+	if c.limit >= 0 {
+		size = min(size, c.limit-c.offset)
+	}
+	buf := make([]byte, size)
+	n, err := view.readAt(buf, c.offset)
+	if err != nil {
+		c.Close()
+		return nil, false, fmt.Errorf("failed to read body of request %d: %w", c.p.Id(), err)
+	}
+	c.offset += int64(n)
+	if (ended && c.offset >= view.size) || (c.limit >= 0 && c.offset >= c.limit) {
+		c.Close()
+	}
+	return buf[:n], c.done, nil
+}
+
+// wait 等待 offset 之后有数据或 body 结束，返回可以在锁外读取的视图
+func (c *BodyCursor) wait() (bodyView, bool, error) {
+	p := c.p
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	body := p.body(c.dataType)
+	if body == nil {
+		// 从持久化存储恢复的请求
+		stored := p.storedBody(c.dataType)
+		return bodyView{chunks: [][]byte{stored}, size: int64(len(stored))}, true, nil
+	}
+
+	var stopWaking func() bool
+	defer func() {
+		if stopWaking != nil {
+			stopWaking()
+		}
+	}()
+
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return bodyView{}, false, err
+		}
+		if !body.released {
+			c.refresh(body)
+		} else if !c.ended {
+			c.Close()
+			return bodyView{}, false, errBodyReleased
+		}
+		// 不能按 state 判断是否结束：服务端可能在请求 body 发送完之前响应
+		if c.offset < c.view.size || c.ended {
+			return c.view, c.ended, nil
+		}
+
+		if stopWaking == nil {
+			// ctx 取消时唤醒等待
+			stopWaking = context.AfterFunc(c.ctx, func() {
+				p.lock.Lock()
+				defer p.lock.Unlock()
+				p.cond.Broadcast()
+			})
+		}
+		p.cond.Wait()
+	}
+}
+
+// refresh 更新视图，body 写入临时文件后持有文件的引用，需要持有 p.lock
+func (c *BodyCursor) refresh(body *bodyBuffer) {
+	if body.file != c.view.file {
+		if body.file != nil {
+			body.file.acquire()
+		}
+		if c.view.file != nil {
+			c.view.file.close()
+		}
+	}
+	c.view = body.view()
+	c.ended = body.ended
+}
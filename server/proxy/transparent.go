@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"log"
+	"net"
+)
+
+// serveTransparent 接受透明代理连接，listener 关闭时返回
+func serveTransparent(listener net.Listener, name string) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go handleTransparentConn(conn, name)
+	}
+}
+
+// handleTransparentConn 恢复原始目标地址后交给与 CONNECT 相同的隧道处理流程，
+// 实际转发目标以 SNI / Host 头为准，原始目标地址仅作为缺失时的兜底
+func handleTransparentConn(conn net.Conn, name string) {
+	target, err := originalDst(conn)
+	if err != nil {
+		log.Printf("Failed to get original destination from %s: %v", conn.RemoteAddr(), err)
+		target = ""
+	} else if target == conn.LocalAddr().String() {
+		// 客户端直接连接了透明代理端口，没有经过重定向
+		target = ""
+	}
+
+	log.Printf("Transparent connection: %s -> %s", conn.RemoteAddr(), target)
+	handleTunnel(conn, target, name)
+}
+
+// originalDst 获取被重定向连接的原始目标地址。
+// REDIRECT 通过 SO_ORIGINAL_DST 获取，TPROXY 下本地地址即为原始目标地址。
+func originalDst(conn net.Conn) (string, error) {
+	tcpConn, ok := unwrapConn(conn).(*net.TCPConn)
+	if !ok {
+		return conn.LocalAddr().String(), nil
+	}
+
+	addr, err := getOriginalDst(tcpConn)
+	if err != nil {
+		return "", err
+	}
+	if addr == nil {
+		return conn.LocalAddr().String(), nil
+	}
+	return addr.String(), nil
+}
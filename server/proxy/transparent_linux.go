@@ -0,0 +1,103 @@
+//go:build linux
+// +build linux
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// SO_ORIGINAL_DST / IP6T_SO_ORIGINAL_DST，定义在 linux/netfilter_ipv4.h
+	soOriginalDst = 80
+	// IPV6_TRANSPARENT，syscall 包中未定义
+	ipv6Transparent = 75
+)
+
+// listenTransparent 创建透明代理监听，TPROXY 模式下设置 IP_TRANSPARENT
+func listenTransparent(addr string, tproxy bool) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if tproxy {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_TRANSPARENT, 1)
+				if sockErr == nil && network == "tcp6" {
+					sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_IPV6, ipv6Transparent, 1)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// getOriginalDst 通过 SO_ORIGINAL_DST 获取 REDIRECT 前的目标地址，
+// 连接没有经过 NAT（如 TPROXY）时返回 nil
+func getOriginalDst(conn *net.TCPConn) (*net.TCPAddr, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	isIPv6 := false
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok && local.IP.To4() == nil {
+		isIPv6 = true
+	}
+
+	var addr *net.TCPAddr
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		if isIPv6 {
+			addr, sockErr = getOriginalDst6(int(fd))
+		} else {
+			addr, sockErr = getOriginalDst4(int(fd))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sockErr == syscall.ENOENT {
+		// 连接没有对应的 conntrack NAT 记录
+		return nil, nil
+	}
+	return addr, sockErr
+}
+
+func getOriginalDst4(fd int) (*net.TCPAddr, error) {
+	// sockaddr_in 与 IPv6Mreq 大小兼容，借用现成的 getsockopt 封装
+	mreq, err := syscall.GetsockoptIPv6Mreq(fd, syscall.IPPROTO_IP, soOriginalDst)
+	if err != nil {
+		return nil, err
+	}
+	raw := mreq.Multiaddr
+	return &net.TCPAddr{
+		IP:   net.IPv4(raw[4], raw[5], raw[6], raw[7]),
+		Port: int(binary.BigEndian.Uint16(raw[2:4])),
+	}, nil
+}
+
+func getOriginalDst6(fd int) (*net.TCPAddr, error) {
+	var raw syscall.RawSockaddrInet6
+	size := uint32(syscall.SizeofSockaddrInet6)
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, uintptr(fd), uintptr(syscall.IPPROTO_IPV6),
+		uintptr(soOriginalDst), uintptr(unsafe.Pointer(&raw)), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	portBytes := (*[2]byte)(unsafe.Pointer(&raw.Port))
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, raw.Addr[:])
+	return &net.TCPAddr{
+		IP:   ip,
+		Port: int(binary.BigEndian.Uint16(portBytes[:])),
+	}, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package proxy
+
+import (
+	"errors"
+	"net"
+)
+
+var errTransparentUnsupported = errors.New("transparent proxy is only supported on linux")
+
+func listenTransparent(addr string, tproxy bool) (net.Listener, error) {
+	return nil, errTransparentUnsupported
+}
+
+func getOriginalDst(conn *net.TCPConn) (*net.TCPAddr, error) {
+	return nil, errTransparentUnsupported
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	transparentChain = "PROXYMAN"
+	transparentTable = "proxyman"
+	transparentMark  = 1
+	transparentRoute = 100
+)
+
+// TransparentRuleOptions 生成透明代理规则的参数
+type TransparentRuleOptions struct {
+	Format string // "iptables" 或 "nft"
+	Port   int    // 透明代理监听端口
+	TProxy bool   // 使用 TPROXY 而不是 REDIRECT
+	UID    string // 只重定向该用户的本机流量
+	Cgroup string // 只重定向该 cgroup v2 路径下进程的本机流量，例如 system.slice/docker.service
+	Ports  []int  // 需要重定向的目标端口，默认 80 和 443
+}
+
+// TransparentRules 生成透明代理所需的 iptables / nftables 规则脚本。
+// 指定 UID 或 Cgroup 时重定向本机进程流量（ProxyMan 自身不能运行在同一用户/cgroup 下，否则会形成回环），
+// 否则重定向经过本机转发的流量（例如容器、局域网设备）。
+func TransparentRules(opts TransparentRuleOptions) (string, error) {
+	if opts.Port <= 0 || opts.Port > 65535 {
+		return "", fmt.Errorf("invalid transparent proxy port %d", opts.Port)
+	}
+	if opts.UID != "" && opts.Cgroup != "" {
+		return "", fmt.Errorf("uid and cgroup can not be used together")
+	}
+	if strings.ContainsAny(opts.UID+opts.Cgroup, "\"'`$;&|\n") {
+		return "", fmt.Errorf("invalid uid or cgroup")
+	}
+	if len(opts.Ports) == 0 {
+		opts.Ports = []int{80, 443}
+	}
+
+	switch opts.Format {
+	case "", "iptables":
+		return iptablesRules(opts), nil
+	case "nft", "nftables":
+		return nftRules(opts), nil
+	default:
+		return "", fmt.Errorf("unsupported rule format %s", opts.Format)
+	}
+}
+
+func joinPorts(ports []int, sep string) string {
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = fmt.Sprintf("%d", port)
+	}
+	return strings.Join(parts, sep)
+}
+
+// iptablesMatch 返回本机流量的 owner / cgroup 匹配条件
+func iptablesMatch(opts TransparentRuleOptions) string {
+	if opts.UID != "" {
+		return fmt.Sprintf("-m owner --uid-owner %s", opts.UID)
+	}
+	if opts.Cgroup != "" {
+		return fmt.Sprintf("-m cgroup --path \"%s\"", opts.Cgroup)
+	}
+	return ""
+}
+
+func iptablesRules(opts TransparentRuleOptions) string {
+	var sb strings.Builder
+	ports := joinPorts(opts.Ports, ",")
+	match := iptablesMatch(opts)
+
+	if !opts.TProxy {
+		sb.WriteString("# ProxyMan transparent proxy rules (iptables REDIRECT)\n")
+		sb.WriteString(fmt.Sprintf("iptables -t nat -N %s\n", transparentChain))
+		sb.WriteString(fmt.Sprintf("iptables -t nat -A %s -d 127.0.0.0/8 -j RETURN\n", transparentChain))
+		sb.WriteString(fmt.Sprintf("iptables -t nat -A %s -p tcp -m multiport --dports %s -j REDIRECT --to-ports %d\n",
+			transparentChain, ports, opts.Port))
+		if match != "" {
+			sb.WriteString(fmt.Sprintf("iptables -t nat -A OUTPUT -p tcp %s -j %s\n", match, transparentChain))
+		} else {
+			sb.WriteString(fmt.Sprintf("iptables -t nat -A PREROUTING -p tcp -j %s\n", transparentChain))
+		}
+
+		sb.WriteString("\n# cleanup\n")
+		if match != "" {
+			sb.WriteString(fmt.Sprintf("# iptables -t nat -D OUTPUT -p tcp %s -j %s\n", match, transparentChain))
+		} else {
+			sb.WriteString(fmt.Sprintf("# iptables -t nat -D PREROUTING -p tcp -j %s\n", transparentChain))
+		}
+		sb.WriteString(fmt.Sprintf("# iptables -t nat -F %s && iptables -t nat -X %s\n", transparentChain, transparentChain))
+		return sb.String()
+	}
+
+	sb.WriteString("# ProxyMan transparent proxy rules (iptables TPROXY)\n")
+	sb.WriteString(fmt.Sprintf("ip rule add fwmark %d lookup %d\n", transparentMark, transparentRoute))
+	sb.WriteString(fmt.Sprintf("ip route add local 0.0.0.0/0 dev lo table %d\n", transparentRoute))
+	sb.WriteString(fmt.Sprintf("iptables -t mangle -N %s\n", transparentChain))
+	sb.WriteString(fmt.Sprintf("iptables -t mangle -A %s -d 127.0.0.0/8 -j RETURN\n", transparentChain))
+	sb.WriteString(fmt.Sprintf("iptables -t mangle -A %s -p tcp -m multiport --dports %s -j TPROXY --on-port %d --tproxy-mark %d\n",
+		transparentChain, ports, opts.Port, transparentMark))
+	sb.WriteString(fmt.Sprintf("iptables -t mangle -A PREROUTING -p tcp -j %s\n", transparentChain))
+	if match != "" {
+		// 本机流量打标后经 lo 重新进入 PREROUTING
+		sb.WriteString(fmt.Sprintf("iptables -t mangle -A OUTPUT -p tcp %s -m multiport --dports %s -j MARK --set-mark %d\n",
+			match, ports, transparentMark))
+	}
+
+	sb.WriteString("\n# cleanup\n")
+	if match != "" {
+		sb.WriteString(fmt.Sprintf("# iptables -t mangle -D OUTPUT -p tcp %s -m multiport --dports %s -j MARK --set-mark %d\n",
+			match, ports, transparentMark))
+	}
+	sb.WriteString(fmt.Sprintf("# iptables -t mangle -D PREROUTING -p tcp -j %s\n", transparentChain))
+	sb.WriteString(fmt.Sprintf("# iptables -t mangle -F %s && iptables -t mangle -X %s\n", transparentChain, transparentChain))
+	sb.WriteString(fmt.Sprintf("# ip rule del fwmark %d lookup %d && ip route flush table %d\n",
+		transparentMark, transparentRoute, transparentRoute))
+	return sb.String()
+}
+
+// nftMatch 返回本机流量的 owner / cgroup 匹配条件
+func nftMatch(opts TransparentRuleOptions) string {
+	if opts.UID != "" {
+		return fmt.Sprintf("meta skuid %s ", opts.UID)
+	}
+	if opts.Cgroup != "" {
+		level := len(strings.Split(strings.Trim(opts.Cgroup, "/"), "/"))
+		return fmt.Sprintf("socket cgroupv2 level %d \"%s\" ", level, strings.Trim(opts.Cgroup, "/"))
+	}
+	return ""
+}
+
+func nftRules(opts TransparentRuleOptions) string {
+	var sb strings.Builder
+	ports := joinPorts(opts.Ports, ", ")
+	match := nftMatch(opts)
+
+	mode := "REDIRECT"
+	if opts.TProxy {
+		mode = "TPROXY"
+	}
+	sb.WriteString(fmt.Sprintf("# ProxyMan transparent proxy rules (nftables %s)\n", mode))
+	sb.WriteString(fmt.Sprintf("nft add table ip %s\n", transparentTable))
+
+	if !opts.TProxy {
+		if match != "" {
+			sb.WriteString(fmt.Sprintf("nft add chain ip %s output '{ type nat hook output priority -100; }'\n", transparentTable))
+			sb.WriteString(fmt.Sprintf("nft add rule ip %s output %sip daddr != 127.0.0.0/8 tcp dport { %s } redirect to :%d\n",
+				transparentTable, match, ports, opts.Port))
+		} else {
+			sb.WriteString(fmt.Sprintf("nft add chain ip %s prerouting '{ type nat hook prerouting priority -100; }'\n", transparentTable))
+			sb.WriteString(fmt.Sprintf("nft add rule ip %s prerouting ip daddr != 127.0.0.0/8 tcp dport { %s } redirect to :%d\n",
+				transparentTable, ports, opts.Port))
+		}
+	} else {
+		sb.WriteString(fmt.Sprintf("ip rule add fwmark %d lookup %d\n", transparentMark, transparentRoute))
+		sb.WriteString(fmt.Sprintf("ip route add local 0.0.0.0/0 dev lo table %d\n", transparentRoute))
+		sb.WriteString(fmt.Sprintf("nft add chain ip %s prerouting '{ type filter hook prerouting priority mangle; }'\n", transparentTable))
+		sb.WriteString(fmt.Sprintf("nft add rule ip %s prerouting ip daddr != 127.0.0.0/8 tcp dport { %s } meta mark set %d tproxy to :%d accept\n",
+			transparentTable, ports, transparentMark, opts.Port))
+		if match != "" {
+			// 本机流量打标后经 lo 重新进入 prerouting
+			sb.WriteString(fmt.Sprintf("nft add chain ip %s output '{ type route hook output priority mangle; }'\n", transparentTable))
+			sb.WriteString(fmt.Sprintf("nft add rule ip %s output %sip daddr != 127.0.0.0/8 tcp dport { %s } meta mark set %d\n",
+				transparentTable, match, ports, transparentMark))
+		}
+	}
+
+	sb.WriteString("\n# cleanup\n")
+	sb.WriteString(fmt.Sprintf("# nft delete table ip %s\n", transparentTable))
+	if opts.TProxy {
+		sb.WriteString(fmt.Sprintf("# ip rule del fwmark %d lookup %d && ip route flush table %d\n",
+			transparentMark, transparentRoute, transparentRoute))
+	}
+	return sb.String()
+}
@@ -0,0 +1,195 @@
+// Package session 读写 proxyMan 会话文件。
+//
+// 会话文件为 zip，保存请求的全部内容，可以无损地重新打开：
+//
+//	manifest.json          会话名称、创建时间和请求数量
+//	requests/<id>.json     请求记录（common.HttpContents，不含 body），包括时间、TLS、标签和备注
+//	bodies/<id>.request    原始请求 body，为空时省略
+//	bodies/<id>.response   原始响应 body，为空时省略
+package session
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"proxyMan/server/common"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Format    = "proxyman-session"
+	Version   = 1
+	Extension = ".proxyman"
+
+	manifestFile = "manifest.json"
+)
+
+// Manifest 会话信息
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Count     int       `json:"count"`
+}
+
+// Writer 逐个写入请求，不需要同时保存所有 body
+type Writer struct {
+	zw        *zip.Writer
+	name      string
+	createdAt time.Time
+	count     int
+}
+
+func NewWriter(w io.Writer, name string) *Writer {
+	return &Writer{zw: zip.NewWriter(w), name: name, createdAt: time.Now()}
+}
+
+// Add 写入一个请求
+func (w *Writer) Add(c *common.HttpContents) error {
+	record := *c
+	record.RequestBody = nil
+	record.ResponseBody = nil
+	if err := w.writeJSON(fmt.Sprintf("requests/%d.json", c.ID), &record); err != nil {
+		return err
+	}
+	if err := w.writeFile(fmt.Sprintf("bodies/%d.request", c.ID), c.RequestBody); err != nil {
+		return err
+	}
+	if err := w.writeFile(fmt.Sprintf("bodies/%d.response", c.ID), c.ResponseBody); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// Close 写入 manifest 并结束 zip
+func (w *Writer) Close() error {
+	manifest := Manifest{Format: Format, Version: Version, Name: w.name, CreatedAt: w.createdAt, Count: w.count}
+	if err := w.writeJSON(manifestFile, &manifest); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+func (w *Writer) writeJSON(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.writeFile(name, data)
+}
+
+func (w *Writer) writeFile(name string, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	f, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: w.createdAt})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// Reader 读取会话文件，请求逐个读取，body 以流的方式提供，不需要同时保存在内存中
+type Reader struct {
+	Manifest
+	files map[string]*zip.File
+	ids   []int64 // 从小到大
+}
+
+// Open 打开会话文件并读取 manifest
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session file: %w", err)
+	}
+
+	s := &Reader{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		s.files[f.Name] = f
+	}
+
+	manifestData, err := readFile(s.files[manifestFile])
+	if err != nil {
+		return nil, fmt.Errorf("invalid session file: %w", err)
+	}
+	if err := json.Unmarshal(manifestData, &s.Manifest); err != nil || s.Format != Format {
+		return nil, fmt.Errorf("invalid session file: not a %s file", Format)
+	}
+	if s.Version > Version {
+		return nil, fmt.Errorf("unsupported session version %d", s.Version)
+	}
+
+	for name := range s.files {
+		idText, ok := strings.CutSuffix(strings.TrimPrefix(name, "requests/"), ".json")
+		if !ok || path.Dir(name) != "requests" {
+			continue
+		}
+		if id, err := strconv.ParseInt(idText, 10, 64); err == nil {
+			s.ids = append(s.ids, id)
+		}
+	}
+	slices.Sort(s.ids)
+	return s, nil
+}
+
+// Each 按原 ID 从小到大读取请求，c 不含 body，requestBody 和 responseBody 只在 fn 执行期间有效
+func (s *Reader) Each(fn func(c *common.HttpContents, requestBody, responseBody io.Reader) error) error {
+	for _, id := range s.ids {
+		name := fmt.Sprintf("requests/%d.json", id)
+		data, err := readFile(s.files[name])
+		if err != nil {
+			return err
+		}
+		c := &common.HttpContents{}
+		if err := json.Unmarshal(data, c); err != nil {
+			return fmt.Errorf("invalid request %s: %w", name, err)
+		}
+		c.ID = id
+
+		requestBody, err := openFile(s.files[fmt.Sprintf("bodies/%d.request", id)])
+		if err != nil {
+			return err
+		}
+		responseBody, err := openFile(s.files[fmt.Sprintf("bodies/%d.response", id)])
+		if err != nil {
+			_ = requestBody.Close()
+			return err
+		}
+		err = fn(c, requestBody, responseBody)
+		_ = requestBody.Close()
+		_ = responseBody.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openFile 打开 zip 中的文件，文件不存在时返回空的 reader
+func openFile(f *zip.File) (io.ReadCloser, error) {
+	if f == nil {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return f.Open()
+}
+
+// readFile 读取 zip 中的文件，文件不存在时返回 nil
+func readFile(f *zip.File) ([]byte, error) {
+	if f == nil {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,441 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"proxyMan/server/common"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errStoreClosed = errors.New("storage is closed")
+
+const (
+	segmentExt = ".seg"
+
+	// 每条记录的头部: 数据长度(4) + 请求 ID(8) + 开始时间 UnixNano(8) + 摘要长度(4)，
+	// 数据由摘要 JSON 和完整记录 JSON 组成，启动时只需读取摘要
+	recordHeaderSize = 24
+
+	maxSegmentBytes   = 16 * 1024 * 1024
+	minSegmentBytes   = 64 * 1024
+	maxSegmentRecords = 4096
+)
+
+// diskStore 基于追加写分段文件的存储。
+// 记录按完成顺序追加到当前段，超过段大小后新建段；保留策略按段整体删除最旧的数据，
+// 启动时只扫描记录头和摘要重建内存索引。
+type diskStore struct {
+	mu        sync.RWMutex
+	dir       string
+	retention Retention
+	segments  []*segment // 从旧到新，最后一个为当前写入段
+	index     map[int64]recordRef
+	ids       []int64 // index 中的 ID，从小到大
+	bytes     int64
+	maxID     int64
+	nextSeq   int
+	closed    bool
+	done      chan struct{}
+}
+
+type segment struct {
+	seq    int
+	file   *os.File
+	size   int64
+	ids    []int64
+	oldest time.Time
+	newest time.Time
+}
+
+type recordRef struct {
+	segment *segment
+	offset  int64 // 完整记录 JSON 的位置
+	length  int
+	summary common.RequestSummary
+}
+
+// OpenDiskStore 打开（或创建）dir 下的分段存储
+func OpenDiskStore(dir string, retention Retention) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create storage dir %s: %w", dir, err)
+	}
+
+	s := &diskStore{
+		dir:       dir,
+		retention: retention,
+		index:     make(map[int64]recordRef),
+		nextSeq:   1,
+		done:      make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		s.closeSegments()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.enforceRetention()
+	s.mu.Unlock()
+
+	go s.retentionLoop()
+	log.Printf("Capture storage opened at %s: %d records, %d bytes", dir, len(s.index), s.bytes)
+	return s, nil
+}
+
+// load 按序号扫描所有段文件重建索引
+func (s *diskStore) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var seqs []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	for _, seq := range seqs {
+		seg, err := s.openSegment(seq)
+		if err != nil {
+			return err
+		}
+		if err := s.scanSegment(seg); err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+		s.bytes += seg.size
+		s.nextSeq = seq + 1
+	}
+	return nil
+}
+
+func (s *diskStore) openSegment(seq int) (*segment, error) {
+	path := filepath.Join(s.dir, fmt.Sprintf("%08d%s", seq, segmentExt))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment %s: %w", path, err)
+	}
+	return &segment{seq: seq, file: file}, nil
+}
+
+// scanSegment 读取段内所有记录头，末尾不完整的记录（写入时崩溃）会被截断
+func (s *diskStore) scanSegment(seg *segment) error {
+	info, err := seg.file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+
+	header := make([]byte, recordHeaderSize)
+	var offset int64
+	for offset < fileSize {
+		if _, err := seg.file.ReadAt(header, offset); err != nil {
+			break
+		}
+		length := int(binary.BigEndian.Uint32(header[0:4]))
+		id := int64(binary.BigEndian.Uint64(header[4:12]))
+		start := time.Unix(0, int64(binary.BigEndian.Uint64(header[12:20])))
+		summaryLength := int(binary.BigEndian.Uint32(header[20:24]))
+		if summaryLength > length || offset+recordHeaderSize+int64(length) > fileSize {
+			break
+		}
+
+		summaryData := make([]byte, summaryLength)
+		if _, err := seg.file.ReadAt(summaryData, offset+recordHeaderSize); err != nil {
+			break
+		}
+		var summary common.RequestSummary
+		if err := json.Unmarshal(summaryData, &summary); err != nil {
+			break
+		}
+
+		dataOffset := offset + recordHeaderSize + int64(summaryLength)
+		s.addRef(id, start, recordRef{segment: seg, offset: dataOffset, length: length - summaryLength, summary: summary})
+		offset += recordHeaderSize + int64(length)
+	}
+
+	if offset < fileSize {
+		log.Printf("Truncating incomplete record in segment %d at offset %d", seg.seq, offset)
+		if err := seg.file.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	seg.size = offset
+	return nil
+}
+
+// addRef 将记录加入索引，需要持有写锁
+func (s *diskStore) addRef(id int64, start time.Time, ref recordRef) {
+	seg := ref.segment
+	if _, ok := s.index[id]; !ok {
+		// 记录按完成顺序保存，ID 基本递增，通常直接追加
+		if n := len(s.ids); n == 0 || s.ids[n-1] < id {
+			s.ids = append(s.ids, id)
+		} else {
+			i, _ := slices.BinarySearch(s.ids, id)
+			s.ids = slices.Insert(s.ids, i, id)
+		}
+	}
+	s.index[id] = ref
+	seg.ids = append(seg.ids, id)
+	if seg.oldest.IsZero() || start.Before(seg.oldest) {
+		seg.oldest = start
+	}
+	if start.After(seg.newest) {
+		seg.newest = start
+	}
+	if id > s.maxID {
+		s.maxID = id
+	}
+}
+
+func (s *diskStore) Save(contents *common.HttpContents) error {
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+	summaryData, err := json.Marshal(contents.RequestSummary)
+	if err != nil {
+		return err
+	}
+
+	var start time.Time
+	if contents.StartTime != nil {
+		start = *contents.StartTime
+	}
+
+	buf := make([]byte, recordHeaderSize+len(summaryData)+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(summaryData)+len(data)))
+	binary.BigEndian.PutUint64(buf[4:12], uint64(contents.ID))
+	binary.BigEndian.PutUint64(buf[12:20], uint64(start.UnixNano()))
+	binary.BigEndian.PutUint32(buf[20:24], uint32(len(summaryData)))
+	copy(buf[recordHeaderSize:], summaryData)
+	copy(buf[recordHeaderSize+len(summaryData):], data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errStoreClosed
+	}
+	seg, err := s.activeSegment()
+	if err != nil {
+		return err
+	}
+	if _, err := seg.file.WriteAt(buf, seg.size); err != nil {
+		return err
+	}
+
+	s.addRef(contents.ID, start, recordRef{
+		segment: seg,
+		offset:  seg.size + recordHeaderSize + int64(len(summaryData)),
+		length:  len(data),
+		summary: contents.RequestSummary,
+	})
+	seg.size += int64(len(buf))
+	s.bytes += int64(len(buf))
+
+	s.enforceRetention()
+	return nil
+}
+
+// activeSegment 返回当前写入段，已满时新建，需要持有写锁
+func (s *diskStore) activeSegment() (*segment, error) {
+	if n := len(s.segments); n > 0 {
+		seg := s.segments[n-1]
+		if seg.size < s.segmentBytes() && len(seg.ids) < s.segmentRecords() {
+			return seg, nil
+		}
+	}
+
+	seg, err := s.openSegment(s.nextSeq)
+	if err != nil {
+		return nil, err
+	}
+	s.nextSeq++
+	s.segments = append(s.segments, seg)
+	return seg, nil
+}
+
+// segmentBytes 段大小上限，保证按段删除时不会一次删掉超过 1/8 的数据
+func (s *diskStore) segmentBytes() int64 {
+	size := int64(maxSegmentBytes)
+	if s.retention.MaxBytes > 0 && s.retention.MaxBytes/8 < size {
+		size = max(s.retention.MaxBytes/8, minSegmentBytes)
+	}
+	return size
+}
+
+func (s *diskStore) segmentRecords() int {
+	records := maxSegmentRecords
+	if s.retention.MaxCount > 0 && s.retention.MaxCount/8 < records {
+		records = max(s.retention.MaxCount/8, 1)
+	}
+	return records
+}
+
+func (s *diskStore) Load(id int64) (*common.HttpContents, error) {
+	s.mu.RLock()
+	ref, ok := s.index[id]
+	if !ok {
+		s.mu.RUnlock()
+		return nil, ErrNotFound
+	}
+	data := make([]byte, ref.length)
+	_, err := ref.segment.file.ReadAt(data, ref.offset)
+	s.mu.RUnlock()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	contents := &common.HttpContents{}
+	if err := json.Unmarshal(data, contents); err != nil {
+		return nil, fmt.Errorf("corrupted record %d: %w", id, err)
+	}
+	return contents, nil
+}
+
+func (s *diskStore) Range(fn func(summary common.RequestSummary) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, ref := range s.index {
+		if !fn(ref.summary) {
+			return
+		}
+	}
+}
+
+func (s *diskStore) RangeByID(desc bool, fn func(summary common.RequestSummary) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.ids {
+		if desc {
+			i = len(s.ids) - 1 - i
+		}
+		if !fn(s.index[s.ids[i]].summary) {
+			return
+		}
+	}
+}
+
+func (s *diskStore) MaxID() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxID
+}
+
+func (s *diskStore) SetRetention(retention Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = retention
+	s.enforceRetention()
+}
+
+func (s *diskStore) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := Stats{Count: len(s.index), Bytes: s.bytes, Segments: len(s.segments)}
+	for _, seg := range s.segments {
+		if len(seg.ids) > 0 {
+			oldest := seg.oldest
+			stats.Oldest = &oldest
+			break
+		}
+	}
+	return stats
+}
+
+// enforceRetention 从最旧的段开始删除，直到满足保留策略，需要持有写锁
+func (s *diskStore) enforceRetention() {
+	for len(s.segments) > 0 {
+		oldest := s.segments[0]
+		expired := s.retention.MaxAge > 0 && !oldest.newest.IsZero() && time.Since(oldest.newest) > s.retention.MaxAge
+		overCount := s.retention.MaxCount > 0 && len(s.index) > s.retention.MaxCount
+		overBytes := s.retention.MaxBytes > 0 && s.bytes > s.retention.MaxBytes
+		if !expired && !overCount && !overBytes {
+			return
+		}
+		s.dropSegment(oldest)
+	}
+}
+
+// dropSegment 删除段文件及其索引，需要持有写锁
+func (s *diskStore) dropSegment(seg *segment) {
+	for _, id := range seg.ids {
+		// 同一 ID 可能在更新的段中重新保存过
+		if ref, ok := s.index[id]; ok && ref.segment == seg {
+			delete(s.index, id)
+		}
+	}
+	s.ids = slices.DeleteFunc(s.ids, func(id int64) bool {
+		_, ok := s.index[id]
+		return !ok
+	})
+	s.bytes -= seg.size
+	s.segments = s.segments[1:]
+
+	name := seg.file.Name()
+	_ = seg.file.Close()
+	if err := os.Remove(name); err != nil {
+		log.Printf("Failed to remove segment %s: %v", name, err)
+	}
+}
+
+// retentionLoop 定期清理过期记录
+func (s *diskStore) retentionLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.enforceRetention()
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *diskStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.closeSegments()
+	return nil
+}
+
+func (s *diskStore) closeSegments() {
+	for _, seg := range s.segments {
+		_ = seg.file.Close()
+	}
+	s.segments = nil
+	s.index = make(map[int64]recordRef)
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"errors"
+	"proxyMan/server/common"
+	"time"
+)
+
+// ErrNotFound 记录不存在或已被清理
+var ErrNotFound = errors.New("record not found")
+
+// Store 抓包记录的持久化存储
+type Store interface {
+	// Save 保存一条已结束的请求记录，相同 ID 重复保存时以最后一次为准
+	Save(contents *common.HttpContents) error
+	// Load 读取指定 ID 的完整记录，不存在时返回 ErrNotFound
+	Load(id int64) (*common.HttpContents, error)
+	// Range 遍历所有记录的摘要，fn 返回 false 时停止，遍历顺序不固定
+	Range(fn func(summary common.RequestSummary) bool)
+	// RangeByID 按 ID 从小到大（desc 时从大到小）遍历摘要，fn 返回 false 时停止
+	RangeByID(desc bool, fn func(summary common.RequestSummary) bool)
+	// MaxID 返回已保存记录的最大 ID，重启后新请求的 ID 从这里继续
+	MaxID() int64
+	// SetRetention 修改保留策略，立即清理超出限制的记录
+	SetRetention(retention Retention)
+	Stats() Stats
+	Close() error
+}
+
+// Retention 保留策略，值为 0 表示不限制
+type Retention struct {
+	MaxCount int
+	MaxAge   time.Duration
+	MaxBytes int64
+}
+
+// Stats 存储使用情况
+type Stats struct {
+	Count    int        `json:"count"`
+	Bytes    int64      `json:"bytes"`
+	Segments int        `json:"segments"`
+	Oldest   *time.Time `json:"oldest,omitempty"`
+}
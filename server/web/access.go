@@ -0,0 +1,78 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+)
+
+// handleAccessConfig 处理代理认证和访问控制配置获取，不返回密码
+func handleAccessConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cfg := proxy.GetAccessConfig()
+	allowedCIDRs := cfg.AllowedCIDRs
+	if allowedCIDRs == nil {
+		allowedCIDRs = []string{}
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"authEnabled":  cfg.AuthEnabled,
+		"username":     cfg.Username,
+		"hasPassword":  cfg.Password != "",
+		"allowedCidrs": allowedCIDRs,
+	})
+}
+
+// handleChangeAccessConfig 处理修改代理认证和访问控制配置请求
+func handleChangeAccessConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		AuthEnabled  bool     `json:"authEnabled"`
+		Username     string   `json:"username"`
+		Password     *string  `json:"password"` // 为空时保留原密码
+		AllowedCIDRs []string `json:"allowedCidrs"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode access config request: %v", err)
+		return
+	}
+
+	cfg := common.AccessConfig{
+		AuthEnabled:  req.AuthEnabled,
+		Username:     req.Username,
+		Password:     proxy.GetAccessConfig().Password,
+		AllowedCIDRs: cleanHostList(req.AllowedCIDRs),
+	}
+	if req.Password != nil && *req.Password != "" {
+		cfg.Password = *req.Password
+	}
+
+	if err := proxy.SetAccessConfig(cfg); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "保存配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// handleRejectedAttempts 返回最近被拒绝的代理访问
+func handleRejectedAttempts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(proxy.GetRejectedAttempts())
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"proxyMan/server/common"
+	"strings"
+)
+
+// authMiddleware 校验 API 令牌。
+// 令牌通过 Authorization: Bearer <token> 传递；浏览器的 WebSocket 和下载链接无法设置请求头，使用 ?token= 参数。
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 预检请求不携带凭据，启用 CORS 时已由 corsMiddleware 处理
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if !common.IsAllowedOrigin(r) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		if !validToken(requestToken(r)) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requestToken 从请求头或查询参数中获取令牌
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
+func validToken(token string) bool {
+	expected := common.GetConfig().APIToken
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
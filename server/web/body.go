@@ -0,0 +1,67 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+)
+
+// handleBodyConfig 处理 body 缓存配置和内存使用情况获取
+func handleBodyConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cfg := proxy.GetBodyConfig()
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"spillThresholdKB": cfg.SpillThresholdKB,
+		"previewKB":        cfg.PreviewKB,
+		"memoryBudgetMB":   cfg.MemoryBudgetMB,
+		"maxBodyMB":        cfg.MaxBodyMB,
+		"spillDir":         cfg.SpillDirPath(),
+		"stats":            proxy.GetBodyStats(),
+	})
+}
+
+// handleChangeBodyConfig 处理修改 body 缓存配置请求
+func handleChangeBodyConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		SpillThresholdKB int    `json:"spillThresholdKB"`
+		PreviewKB        int    `json:"previewKB"`
+		MemoryBudgetMB   int    `json:"memoryBudgetMB"`
+		MaxBodyMB        int    `json:"maxBodyMB"`
+		SpillDir         string `json:"spillDir"` // 为空时使用系统临时目录
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode body config request: %v", err)
+		return
+	}
+
+	cfg := common.BodyConfig{
+		SpillThresholdKB: req.SpillThresholdKB,
+		PreviewKB:        req.PreviewKB,
+		MemoryBudgetMB:   req.MemoryBudgetMB,
+		MaxBodyMB:        req.MaxBodyMB,
+		SpillDir:         req.SpillDir,
+	}
+	if err := proxy.SetBodyConfig(cfg); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "保存配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+)
+
+// handleCacheConfig 处理请求记录缓存配置和使用情况获取
+func handleCacheConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cfg := proxy.GetCacheConfig()
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"maxCount":  cfg.MaxCount,
+		"maxSizeMB": cfg.MaxSizeMB,
+		"eviction":  cfg.Eviction,
+		"stats":     proxy.GetCacheStats(),
+		"body":      proxy.GetBodyStats(),
+	})
+}
+
+// handleChangeCacheConfig 处理修改请求记录缓存配置请求
+func handleChangeCacheConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		MaxCount  int    `json:"maxCount"`
+		MaxSizeMB int    `json:"maxSizeMB"`
+		Eviction  string `json:"eviction"` // lru 或 age，为空时使用 lru
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode cache config request: %v", err)
+		return
+	}
+
+	cfg := common.CacheConfig{
+		MaxCount:  req.MaxCount,
+		MaxSizeMB: req.MaxSizeMB,
+		Eviction:  req.Eviction,
+	}
+	if err := proxy.SetCacheConfig(cfg); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "保存配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// handlePinRequest 处理固定或取消固定请求
+func handlePinRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		ID     int64 `json:"id"`
+		Pinned bool  `json:"pinned"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode pin request: %v", err)
+		return
+	}
+
+	if err := proxy.PinProxy(req.ID, req.Pinned); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
@@ -0,0 +1,29 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"proxyMan/server/codegen"
+	"proxyMan/server/proxy"
+)
+
+// handleRequestCode 将请求生成为代码，lang 参数为 curl（默认）、go、python 或 fetch
+func handleRequestCode(w http.ResponseWriter, r *http.Request, dataProxy *proxy.DataProxy) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		lang = "curl"
+	}
+	code, err := codegen.Render(lang, dataProxy.Snapshot())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, code)
+}
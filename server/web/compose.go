@@ -0,0 +1,110 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"proxyMan/server/proxy"
+	"time"
+)
+
+// composeRequest 构造请求的参数，body 的格式与请求详情相同（{"encoding": "utf8|base64", "data": "..."}），timeout 单位为秒
+type composeRequest struct {
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	Headers         map[string]string `json:"headers"`
+	Body            *encodedBody      `json:"body"`
+	HTTPVersion     string            `json:"httpVersion"`
+	Timeout         float64           `json:"timeout"`
+	FollowRedirects bool              `json:"followRedirects"`
+}
+
+// handleCompose 发送手工构造的请求，等待响应结束后返回新请求的 ID 和结果。
+// 请求体为 JSON；上传文件作为 body 时使用 multipart/form-data，request 字段为 JSON 参数，body 字段为文件
+func handleCompose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, body, err := readComposeRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		log.Printf("Failed to decode compose request: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	result, err := proxy.Compose(r.Context(), proxy.ComposeRequest{
+		Method:          req.Method,
+		URL:             req.URL,
+		Headers:         req.Headers,
+		Body:            body,
+		HTTPVersion:     req.HTTPVersion,
+		Timeout:         time.Duration(req.Timeout * float64(time.Second)),
+		FollowRedirects: req.FollowRedirects,
+	})
+	if err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+		"result": result,
+	})
+}
+
+// readComposeRequest 读取构造请求的参数和请求 body
+func readComposeRequest(r *http.Request) (composeRequest, []byte, error) {
+	var req composeRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, nil, err
+		}
+		if req.Body == nil {
+			return req, nil, nil
+		}
+		body, err := req.Body.decode()
+		return req, body, err
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return req, nil, err
+	}
+	// 上传的文件优先于 JSON 中的 body
+	var body []byte
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return req, nil, err
+		}
+		switch part.FormName() {
+		case "request":
+			err = json.NewDecoder(part).Decode(&req)
+		case "body":
+			body, err = io.ReadAll(part)
+		}
+		_ = part.Close()
+		if err != nil {
+			return req, nil, fmt.Errorf("invalid %s: %w", part.FormName(), err)
+		}
+	}
+	if body == nil && req.Body != nil {
+		body, err = req.Body.decode()
+	}
+	return req, body, err
+}
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// detailWriter 按客户端选择的格式发送 DataChunk：默认为 JSON（data 为 base64），
+// format=binary 时为二进制帧（见 DataChunk.MarshalBinary）
+type detailWriter struct {
+	conn    *common.WSConn
+	binary  bool
+	offsets map[common.DataType]int64
+}
+
+func (w *detailWriter) write(dataType common.DataType, data []byte, finished bool) error {
+	chunk := common.NewDataChunk(dataType, data, finished)
+	chunk.Offset = w.offsets[dataType]
+	w.offsets[dataType] += int64(len(data))
+
+	if !w.binary {
+		return w.conn.WriteJSON(&chunk)
+	}
+	frame, err := chunk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.conn.WriteBinary(frame)
+}
+
+// handleDetail 推送请求的完整内容。可选参数：
+// format=binary 使用二进制帧；body=request|response 和 range=start-end（包含 end，end 可省略）只推送 body 的一部分
+func handleDetail(r *http.Request, conn *common.WSConn) {
+	params := r.URL.Query()
+	writer := &detailWriter{conn: conn, binary: params.Get("format") == "binary", offsets: map[common.DataType]int64{}}
+
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 || pathParts[3] == "" {
+		sendErr(writer, "Request ID is required")
+		return
+	}
+
+	requestID := pathParts[3]
+	log.Printf("Detail streaming client connected for request: %s", requestID)
+	// 安全的ID转换和验证
+	var id int64
+	if _, err := fmt.Sscanf(requestID, "%d", &id); err != nil {
+		sendErr(writer, "Invalid request ID format")
+		return
+	}
+
+	dataProxy := proxy.GetProxy(id)
+	if dataProxy == nil {
+		sendErr(writer, "Detail info has been cleaned!")
+		return
+	}
+
+	cb := func(dataType common.DataType, data []byte, time time.Time, finished bool) error {
+		return writer.write(dataType, data, finished)
+	}
+	// 客户端断开或写入失败时停止推送
+	ctx := conn.Context()
+
+	var err error
+	if params.Has("body") || params.Has("range") {
+		dataType, start, end, parseErr := parseBodyRange(params.Get("body"), params.Get("range"))
+		if parseErr != nil {
+			sendErr(writer, parseErr.Error())
+			return
+		}
+		writer.offsets[dataType] = start
+		err = dataProxy.OnBodyRange(ctx, dataType, start, end, cb)
+	} else {
+		// 启动数据流处理
+		err = dataProxy.OnData(ctx, cb)
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Detail streaming failed for request: %s, reason: %s", requestID, err)
+	}
+}
+
+// parseBodyRange 解析 body（request / response，默认 response）和 range（start-end 或 start-），end 为 -1 表示直到结束
+func parseBodyRange(body, byteRange string) (dataType common.DataType, start, end int64, err error) {
+	switch body {
+	case "", "response":
+		dataType = common.ResponseBody
+	case "request":
+		dataType = common.RequestBody
+	default:
+		return 0, 0, 0, fmt.Errorf("Invalid body: %s", body)
+	}
+
+	end = -1
+	if byteRange == "" {
+		return dataType, 0, end, nil
+	}
+	startText, endText, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("Invalid range: %s", byteRange)
+	}
+	if start, err = strconv.ParseInt(startText, 10, 64); err != nil || start < 0 {
+		return 0, 0, 0, fmt.Errorf("Invalid range: %s", byteRange)
+	}
+	if endText != "" {
+		if end, err = strconv.ParseInt(endText, 10, 64); err != nil || end < start {
+			return 0, 0, 0, fmt.Errorf("Invalid range: %s", byteRange)
+		}
+	}
+	return dataType, start, end, nil
+}
+
+func sendErr(writer *detailWriter, msg string) {
+	if writeErr := writer.write(common.ERROR, []byte(msg), true); writeErr != nil {
+		log.Printf("Failed to send error message: %s cause: %v", msg, writeErr)
+	}
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"proxyMan/server/har"
+	"proxyMan/server/proxy"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleExportHar 导出 HAR 1.2。ids=1,2,3 导出指定的请求，否则按 /api/requests 的过滤参数导出，
+// 默认导出全部请求并按 ID 从旧到新排列
+func handleExportHar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids, err := exportIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="proxyman-%s.har"`, time.Now().Format("20060102-150405")))
+
+	writer := har.NewWriter(w)
+	for _, id := range ids {
+		dataProxy := proxy.GetProxy(id)
+		if dataProxy == nil {
+			continue
+		}
+		if err := writer.Write(har.NewEntry(dataProxy.Snapshot())); err != nil {
+			log.Printf("Failed to export HAR: %v", err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("Failed to export HAR: %v", err)
+	}
+}
+
+// exportIDs 返回需要导出的请求 ID
+func exportIDs(r *http.Request) ([]int64, error) {
+	params := r.URL.Query()
+	if value := params.Get("ids"); value != "" {
+		var ids []int64
+		for _, text := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid ids")
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+
+	q, err := parseRequestQuery(params)
+	if err != nil {
+		return nil, err
+	}
+	q.Asc = params.Get("order") != "desc"
+
+	var ids []int64
+	for _, summary := range proxy.ListRequests(q).Items {
+		ids = append(ids, summary.ID)
+	}
+	return ids, nil
+}
+
+// maxImportSize 导入的 HAR 和会话文件的大小上限
+const maxImportSize = 1 << 30
+
+// handleImportHar 导入请求体中的 HAR 文件，导入的请求为只读并标记为 imported，无法解析的 entry 被跳过。
+// entry 逐个读取和导入，文件格式错误时已导入的请求保留
+func handleImportHar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := har.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize))
+	ids := []int64{}
+	skipped := 0
+	for {
+		entry, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to import HAR after %d requests: %v", len(ids), err)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":  false,
+				"msg":     err.Error(),
+				"ids":     ids,
+				"skipped": skipped,
+			})
+			return
+		}
+
+		c, err := entry.Contents()
+		if err != nil {
+			log.Printf("Skipping HAR entry: %v", err)
+			skipped++
+			continue
+		}
+		ids = append(ids, proxy.ImportRequest(c, bytes.NewReader(c.RequestBody), bytes.NewReader(c.ResponseBody)))
+	}
+
+	log.Printf("Imported %d requests from HAR, skipped %d", len(ids), skipped)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"ids":     ids,
+		"skipped": skipped,
+	})
+}
@@ -0,0 +1,221 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+	"regexp"
+	"time"
+)
+
+var listenerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// handleListeners 返回所有代理监听及其运行状态
+func handleListeners(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(proxy.GetListeners())
+}
+
+// handleSaveListener 新增或修改代理监听，保存后按 enabled 启动或停止
+func handleSaveListener(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req common.ListenerConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode listener request: %v", err)
+		return
+	}
+
+	if msg := validateListener(&req); msg != "" {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    msg,
+		})
+		return
+	}
+
+	if err := common.SaveListenerConfig(req); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "Failed to save listener config: " + err.Error(),
+		})
+		return
+	}
+
+	if !req.Enabled {
+		proxy.StopListener(req.Name, proxy.DefaultDrainTimeout)
+	} else if err := proxy.StartListener(req); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// handleStartListener 启动已保存的代理监听
+func handleStartListener(w http.ResponseWriter, r *http.Request) {
+	changeListenerState(w, r, true)
+}
+
+// handleStopListener 优雅停止代理监听，等待进行中的请求完成后返回
+func handleStopListener(w http.ResponseWriter, r *http.Request) {
+	changeListenerState(w, r, false)
+}
+
+// changeListenerState 启动或停止监听，并持久化 enabled 状态
+// 请求参数: name=监听名称（为空时为默认监听）, timeout=停止时等待连接排空的秒数
+func changeListenerState(w http.ResponseWriter, r *http.Request, enabled bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Name    string `json:"name"`
+		Timeout int    `json:"timeout"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = common.DefaultListener
+	}
+	if req.Timeout < 0 {
+		http.Error(w, "Timeout must not be negative", http.StatusBadRequest)
+		return
+	}
+	timeout := proxy.DefaultDrainTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+
+	cfg, ok := common.GetListenerConfig(req.Name)
+	if !ok {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "Listener not found: " + req.Name,
+		})
+		return
+	}
+
+	if enabled {
+		if err := proxy.StartListener(cfg); err != nil {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": false,
+				"msg":    err.Error(),
+			})
+			return
+		}
+	} else {
+		proxy.StopListener(cfg.Name, timeout)
+	}
+
+	cfg.Enabled = enabled
+	if err := common.SaveListenerConfig(cfg); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "Failed to save listener config: " + err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// handleRemoveListener 停止并删除代理监听，默认监听不可删除
+func handleRemoveListener(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == common.DefaultListener {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "The default listener can not be removed",
+		})
+		return
+	}
+
+	proxy.StopListener(req.Name, proxy.DefaultDrainTimeout)
+	if err := common.RemoveListenerConfig(req.Name); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "Failed to save listener config: " + err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// validateListener 校验监听配置并补全默认值，返回错误信息
+func validateListener(cfg *common.ListenerConfig) string {
+	if !listenerNamePattern.MatchString(cfg.Name) {
+		return "Listener name must be 1-32 letters, digits, '-' or '_'"
+	}
+
+	switch cfg.Mode {
+	case common.ListenerModeHTTP, common.ListenerModeSocks, common.ListenerModeReverse:
+		if cfg.Host == "" {
+			cfg.Host = "127.0.0.1"
+		}
+	case common.ListenerModeTransparent:
+		// 透明代理需要接收其他主机或本机重定向过来的流量
+		if cfg.Host == "" {
+			cfg.Host = "0.0.0.0"
+		}
+	default:
+		return "Unsupported listener mode: " + cfg.Mode
+	}
+
+	if cfg.Name == common.DefaultListener && cfg.Mode != common.ListenerModeHTTP {
+		return "The default listener must be an http listener"
+	}
+	if cfg.Mode == common.ListenerModeReverse && cfg.Target == "" {
+		return "Reverse listener target is required"
+	}
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		return "Port must be between 1 and 65535"
+	}
+
+	// 同一地址和端口只能有一个监听
+	for _, other := range common.GetConfig().Listeners {
+		if other.Name != cfg.Name && other.Port == cfg.Port && other.Host == cfg.Host {
+			return "Address is already used by listener " + other.Name
+		}
+	}
+	return ""
+}
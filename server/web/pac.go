@@ -0,0 +1,151 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+	"strconv"
+	"strings"
+)
+
+// handleProxyPAC 根据选择性抓包配置生成 PAC 文件
+// 每次请求都使用最新配置生成，配置修改后浏览器重新拉取即可生效
+func handleProxyPAC(w http.ResponseWriter, r *http.Request) {
+	cfg := common.GetConfig().Capture
+
+	proxyHost := proxy.GetCurrentProxyHost()
+	// 监听所有地址时，使用客户端访问 Web 服务器的地址
+	if proxyHost == "" || proxyHost == "0.0.0.0" || proxyHost == "::" {
+		proxyHost = r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			proxyHost = h
+		}
+	}
+	proxyAddr := net.JoinHostPort(proxyHost, strconv.Itoa(proxy.GetCurrentProxyPort()))
+
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	_, _ = w.Write([]byte(generatePAC(cfg, proxyAddr)))
+}
+
+// generatePAC 生成 PAC 脚本内容
+func generatePAC(cfg common.CaptureConfig, proxyAddr string) string {
+	var sb strings.Builder
+	sb.WriteString("// Generated by ProxyMan\n")
+	sb.WriteString("function FindProxyForURL(url, host) {\n")
+	sb.WriteString("    host = host.toLowerCase();\n")
+
+	for _, pattern := range cfg.ExcludeHosts {
+		if cond := pacHostCondition(pattern); cond != "" {
+			sb.WriteString(fmt.Sprintf("    if (%s) return \"DIRECT\";\n", cond))
+		}
+	}
+
+	proxyResult := fmt.Sprintf("PROXY %s; DIRECT", proxyAddr)
+	if len(cfg.IncludeHosts) == 0 {
+		sb.WriteString(fmt.Sprintf("    return %q;\n", proxyResult))
+	} else {
+		for _, pattern := range cfg.IncludeHosts {
+			if cond := pacHostCondition(pattern); cond != "" {
+				sb.WriteString(fmt.Sprintf("    if (%s) return %q;\n", cond, proxyResult))
+			}
+		}
+		sb.WriteString("    return \"DIRECT\";\n")
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// pacHostCondition 将域名规则转换为 PAC 判断条件，规则与 common.MatchHost 保持一致
+func pacHostCondition(pattern string) string {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return ""
+	}
+
+	quoted, _ := json.Marshal(pattern)
+	if strings.ContainsAny(pattern, "*?[") {
+		return fmt.Sprintf("shExpMatch(host, %s)", quoted)
+	}
+	suffix, _ := json.Marshal("." + pattern)
+	return fmt.Sprintf("host == %s || dnsDomainIs(host, %s)", quoted, suffix)
+}
+
+// handleCaptureConfig 处理选择性抓包配置获取
+func handleCaptureConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cfg := common.GetConfig().Capture
+	includeHosts := cfg.IncludeHosts
+	if includeHosts == nil {
+		includeHosts = []string{}
+	}
+	excludeHosts := cfg.ExcludeHosts
+	if excludeHosts == nil {
+		excludeHosts = []string{}
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"includeHosts": includeHosts,
+		"excludeHosts": excludeHosts,
+		"pacPath":      "/proxy.pac",
+	})
+}
+
+// handleChangeCaptureConfig 处理修改选择性抓包配置请求
+func handleChangeCaptureConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		IncludeHosts []string `json:"includeHosts"`
+		ExcludeHosts []string `json:"excludeHosts"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode capture config request: %v", err)
+		return
+	}
+
+	cfg := common.CaptureConfig{
+		IncludeHosts: cleanHostList(req.IncludeHosts),
+		ExcludeHosts: cleanHostList(req.ExcludeHosts),
+	}
+
+	if err := common.UpdateCaptureConfig(cfg); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "保存配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// cleanHostList 去除空白和重复的域名
+func cleanHostList(hosts []string) []string {
+	result := make([]string, 0, len(hosts))
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		result = append(result, host)
+	}
+	return result
+}
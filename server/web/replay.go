@@ -0,0 +1,59 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"proxyMan/server/proxy"
+)
+
+// replayRequest 重放参数，body 的格式与请求详情相同（{"encoding": "utf8|base64", "data": "..."}）
+type replayRequest struct {
+	Headers     map[string]string `json:"headers"`
+	Body        *encodedBody      `json:"body"`
+	Repeat      int               `json:"repeat"`
+	Concurrency int               `json:"concurrency"`
+}
+
+// handleReplayRequest 重放请求，请求体为空时按原样重放一次。等待所有重放结束后返回每次重放的新请求 ID 和结果
+func handleReplayRequest(w http.ResponseWriter, r *http.Request, dataProxy *proxy.DataProxy) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req replayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode replay request: %v", err)
+		return
+	}
+
+	opts := proxy.ReplayOptions{Headers: req.Headers, Repeat: req.Repeat, Concurrency: req.Concurrency}
+	if req.Body != nil {
+		body, err := req.Body.decode()
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Body = body
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	results, err := dataProxy.Replay(r.Context(), opts)
+	if err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"results": results,
+	})
+}
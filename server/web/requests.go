@@ -0,0 +1,296 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// encodedBody JSON 中的 body，文本使用 utf8，二进制使用 base64
+type encodedBody struct {
+	Encoding string `json:"encoding"`
+	Data     string `json:"data"`
+	Size     int    `json:"size"`
+}
+
+// requestDetail 请求的完整内容
+type requestDetail struct {
+	common.RequestSummary
+	RequestHeaders  http.Header     `json:"requestHeaders"`
+	RequestBody     encodedBody     `json:"requestBody"`
+	ResponseHeaders http.Header     `json:"responseHeaders"`
+	ResponseBody    encodedBody     `json:"responseBody"`
+	Error           string          `json:"error,omitempty"`
+	Timing          common.Timing   `json:"timing"`
+	TLS             *common.TLSInfo `json:"tls,omitempty"`
+	Notes           string          `json:"notes,omitempty"`
+}
+
+// handleRequests 处理请求列表查询，支持分页、排序和过滤：
+// host、method、statusMin、statusMax、contentType、from、to（RFC3339 或毫秒时间戳）、
+// q（URL 包含）、tag、session（会话名称）、replayOf（重放的原请求 ID）、sort、order（asc / desc）、offset、limit
+func handleRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := parseRequestQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !r.URL.Query().Has("limit") {
+		q.Limit = defaultPageSize
+	}
+	if q.Limit == 0 || q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(proxy.ListRequests(q))
+}
+
+// parseRequestQuery 解析请求列表的查询参数，没有 limit 时不限制数量
+func parseRequestQuery(params url.Values) (proxy.RequestQuery, error) {
+	q := proxy.RequestQuery{
+		Host:        params.Get("host"),
+		Method:      params.Get("method"),
+		ContentType: params.Get("contentType"),
+		Search:      params.Get("q"),
+		Tag:         params.Get("tag"),
+		Session:     params.Get("session"),
+		Sort:        params.Get("sort"),
+		Asc:         params.Get("order") == "asc",
+	}
+
+	var err error
+	for name, target := range map[string]*int{
+		"statusMin": &q.StatusMin,
+		"statusMax": &q.StatusMax,
+		"offset":    &q.Offset,
+		"limit":     &q.Limit,
+	} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		if *target, err = strconv.Atoi(value); err != nil || *target < 0 {
+			return q, fmt.Errorf("Invalid %s", name)
+		}
+	}
+	if value := params.Get("replayOf"); value != "" {
+		if q.ReplayOf, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return q, fmt.Errorf("Invalid replayOf")
+		}
+	}
+	if q.From, err = parseTimeParam(params.Get("from")); err != nil {
+		return q, fmt.Errorf("Invalid from")
+	}
+	if q.To, err = parseTimeParam(params.Get("to")); err != nil {
+		return q, fmt.Errorf("Invalid to")
+	}
+	return q, nil
+}
+
+// handleRequest 处理 /api/requests/{id} 及其子路径 /api/requests/{id}/replay、/api/requests/{id}/code
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	idText, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/requests/"), "/")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid request ID format", http.StatusBadRequest)
+		return
+	}
+
+	dataProxy := proxy.GetProxy(id)
+	if dataProxy == nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "":
+		handleRequestDetail(w, r, dataProxy)
+	case "replay":
+		handleReplayRequest(w, r, dataProxy)
+	case "code":
+		handleRequestCode(w, r, dataProxy)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleRequestDetail 返回单个请求的完整内容，encoding 参数可指定 body 编码（utf8 / base64），默认自动选择
+func handleRequestDetail(w http.ResponseWriter, r *http.Request, dataProxy *proxy.DataProxy) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	encoding := r.URL.Query().Get("encoding")
+	contents := dataProxy.Snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(requestDetail{
+		RequestSummary:  contents.RequestSummary,
+		RequestHeaders:  contents.RequestHeaders,
+		RequestBody:     encodeBody(contents.RequestBody, encoding),
+		ResponseHeaders: contents.ResponseHeaders,
+		ResponseBody:    encodeBody(contents.ResponseBody, encoding),
+		Error:           contents.Error,
+		Timing:          contents.Timing,
+		TLS:             contents.TLS,
+		Notes:           contents.Notes,
+	})
+}
+
+func encodeBody(data []byte, encoding string) encodedBody {
+	if encoding == "" {
+		encoding = "utf8"
+		if !utf8.Valid(data) {
+			encoding = "base64"
+		}
+	}
+
+	if encoding == "base64" {
+		return encodedBody{Encoding: encoding, Data: base64.StdEncoding.EncodeToString(data), Size: len(data)}
+	}
+	return encodedBody{Encoding: "utf8", Data: strings.ToValidUTF8(string(data), "�"), Size: len(data)}
+}
+
+// decode 返回 body 的原始数据，忽略 size
+func (b encodedBody) decode() ([]byte, error) {
+	if b.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Data)
+	}
+	return []byte(b.Data), nil
+}
+
+// parseTimeParam 解析 RFC3339 时间或毫秒时间戳
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleTagRequest 处理设置请求标签，tags 替换原有的标签
+func handleTagRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		ID   int64    `json:"id"`
+		Tags []string `json:"tags"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode tag request: %v", err)
+		return
+	}
+
+	if err := proxy.SetTags(req.ID, req.Tags); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// handleNotesRequest 处理设置请求备注
+func handleNotesRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		ID    int64  `json:"id"`
+		Notes string `json:"notes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode notes request: %v", err)
+		return
+	}
+
+	if err := proxy.SetNotes(req.ID, req.Notes); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
+
+// requestFilter /requests 客户端的订阅条件
+type requestFilter struct {
+	proxy.SummaryFilter
+}
+
+func (f requestFilter) Match(data any) bool {
+	summary, ok := data.(common.RequestSummary)
+	return !ok || f.SummaryFilter.Match(summary)
+}
+
+// parseRequestFilter 解析 /requests 客户端发送的订阅条件，null 或空对象表示不过滤
+func parseRequestFilter(data []byte) (common.WsFilter, error) {
+	var filter proxy.SummaryFilter
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &filter); err != nil {
+			return nil, err
+		}
+	}
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+	return requestFilter{filter}, nil
+}
+
+// requestSnapshot /requests 连接时或修改订阅条件后发送的快照
+func requestSnapshot(r *http.Request, since int64, filter common.WsFilter) any {
+	summaries := proxy.SummariesSince(since)
+	if filter == nil {
+		return summaries
+	}
+	matched := []common.RequestSummary{}
+	for _, summary := range summaries {
+		if filter.Match(summary) {
+			matched = append(matched, summary)
+		}
+	}
+	return matched
+}
@@ -12,26 +12,27 @@ import (
 	"proxyMan/server/cert"
 	"proxyMan/server/common"
 	"proxyMan/server/proxy"
+	"strconv"
 	"strings"
-	"time"
 )
 
 // WebSocket client management for real-time monitoring
 var (
+	ServerHost string
 	ServerPort int
 	EnableCORS = false // 是否启用 CORS，默认禁用
 )
 
-// corsMiddleware CORS 中间件，仅在 EnableCORS 为 true 时生效
+// corsMiddleware CORS 中间件，仅在 EnableCORS 为 true 时生效，只对可信的 Origin 返回 CORS 头
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if EnableCORS {
 			origin := r.Header.Get("Origin")
-			if origin != "" {
-				w.Header().Set("Access-Control-Allow-Origin", "*")
-				w.Header().Set("Access-Control-Allow-Methods", "*")
-				w.Header().Set("Access-Control-Allow-Headers", "*")
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			if origin != "" && common.IsAllowedOrigin(r) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Add("Vary", "Origin")
 			}
 
 			// 处理预检请求
@@ -45,7 +46,8 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func StartWebServer(index *embed.FS, port int) error {
+// StartWebServer 启动 Web 管理界面，host 默认为 127.0.0.1，只允许本机访问
+func StartWebServer(index *embed.FS, host string, port int) error {
 	distFS, err := fs.Sub(*index, "frontend/dist")
 	if err != nil {
 		return fmt.Errorf("failed to create sub filesystem: %w", err)
@@ -54,36 +56,79 @@ func StartWebServer(index *embed.FS, port int) error {
 
 	// Real-time monitoring WebSocket (lightweight summaries)
 	//http.HandleFunc("/status", common.SystemStatus.Handle)
-	http.HandleFunc("/requests", common.ReqSummary.Handle)
+	common.ReqSummary.SetSnapshot(requestSnapshot)
+	common.ReqSummary.SetFilter(parseRequestFilter)
+	http.HandleFunc("/requests", authMiddleware(common.ReqSummary.Handle))
 	// Detail streaming WebSocket (full request details)
-	http.HandleFunc("/requests/details/", common.NewWsHandler(handleDetail).Handle)
+	http.HandleFunc("/requests/details/", authMiddleware(common.NewWsHandler(handleDetail).Handle))
 
 	// HTTP API endpoints (使用 CORS 中间件)
-	http.HandleFunc("/api/proxy/config", corsMiddleware(handleProxyConfig))
-	http.HandleFunc("/api/proxy/change", corsMiddleware(handleChangeProxy))
-	http.HandleFunc("/api/proxy/upstream/config", corsMiddleware(handleUpstreamProxyConfig))
-	http.HandleFunc("/api/proxy/upstream/change", corsMiddleware(handleChangeUpstreamProxy))
-	http.HandleFunc("/api/cert/status", corsMiddleware(handleCertStatus))
-	http.HandleFunc("/api/cert/install", corsMiddleware(handleCertInstall))
-	http.HandleFunc("/api/cert/uninstall", corsMiddleware(handleCertUninstall))
-	http.HandleFunc("/api/cert/install-script", corsMiddleware(handleInstallScript))
-	http.HandleFunc("/api/cert/uninstall-script", corsMiddleware(handleUninstallScript))
-
-	portStr := fmt.Sprintf(":%d", port)
+	http.HandleFunc("/api/proxy/config", corsMiddleware(authMiddleware(handleProxyConfig)))
+	http.HandleFunc("/api/proxy/change", corsMiddleware(authMiddleware(handleChangeProxy)))
+	http.HandleFunc("/api/proxy/start", corsMiddleware(authMiddleware(handleStartListener)))
+	http.HandleFunc("/api/proxy/stop", corsMiddleware(authMiddleware(handleStopListener)))
+	http.HandleFunc("/api/proxy/transparent/rules", corsMiddleware(authMiddleware(handleTransparentRules)))
+	http.HandleFunc("/api/listeners", corsMiddleware(authMiddleware(handleListeners)))
+	http.HandleFunc("/api/listeners/save", corsMiddleware(authMiddleware(handleSaveListener)))
+	http.HandleFunc("/api/listeners/start", corsMiddleware(authMiddleware(handleStartListener)))
+	http.HandleFunc("/api/listeners/stop", corsMiddleware(authMiddleware(handleStopListener)))
+	http.HandleFunc("/api/listeners/remove", corsMiddleware(authMiddleware(handleRemoveListener)))
+	http.HandleFunc("/api/proxy/upstream/config", corsMiddleware(authMiddleware(handleUpstreamProxyConfig)))
+	http.HandleFunc("/api/proxy/upstream/change", corsMiddleware(authMiddleware(handleChangeUpstreamProxy)))
+	http.HandleFunc("/api/cert/status", corsMiddleware(authMiddleware(handleCertStatus)))
+	http.HandleFunc("/api/cert/install", corsMiddleware(authMiddleware(handleCertInstall)))
+	http.HandleFunc("/api/cert/uninstall", corsMiddleware(authMiddleware(handleCertUninstall)))
+	http.HandleFunc("/api/cert/install-script", corsMiddleware(authMiddleware(handleInstallScript)))
+	http.HandleFunc("/api/cert/uninstall-script", corsMiddleware(authMiddleware(handleUninstallScript)))
+	http.HandleFunc("/api/capture/config", corsMiddleware(authMiddleware(handleCaptureConfig)))
+	http.HandleFunc("/api/capture/change", corsMiddleware(authMiddleware(handleChangeCaptureConfig)))
+	http.HandleFunc("/api/access/config", corsMiddleware(authMiddleware(handleAccessConfig)))
+	http.HandleFunc("/api/access/change", corsMiddleware(authMiddleware(handleChangeAccessConfig)))
+	http.HandleFunc("/api/access/rejected", corsMiddleware(authMiddleware(handleRejectedAttempts)))
+	http.HandleFunc("/api/storage/config", corsMiddleware(authMiddleware(handleStorageConfig)))
+	http.HandleFunc("/api/storage/change", corsMiddleware(authMiddleware(handleChangeStorageConfig)))
+	http.HandleFunc("/api/body/config", corsMiddleware(authMiddleware(handleBodyConfig)))
+	http.HandleFunc("/api/body/change", corsMiddleware(authMiddleware(handleChangeBodyConfig)))
+	http.HandleFunc("/api/cache/config", corsMiddleware(authMiddleware(handleCacheConfig)))
+	http.HandleFunc("/api/cache/change", corsMiddleware(authMiddleware(handleChangeCacheConfig)))
+	http.HandleFunc("/api/cache/pin", corsMiddleware(authMiddleware(handlePinRequest)))
+	http.HandleFunc("/api/requests", corsMiddleware(authMiddleware(handleRequests)))
+	http.HandleFunc("/api/requests/", corsMiddleware(authMiddleware(handleRequest)))
+	http.HandleFunc("/api/requests/tags", corsMiddleware(authMiddleware(handleTagRequest)))
+	http.HandleFunc("/api/requests/notes", corsMiddleware(authMiddleware(handleNotesRequest)))
+	http.HandleFunc("/api/compose", corsMiddleware(authMiddleware(handleCompose)))
+	http.HandleFunc("/api/export/har", corsMiddleware(authMiddleware(handleExportHar)))
+	http.HandleFunc("/api/import/har", corsMiddleware(authMiddleware(handleImportHar)))
+	http.HandleFunc("/api/session/save", corsMiddleware(authMiddleware(handleSaveSession)))
+	http.HandleFunc("/api/session/load", corsMiddleware(authMiddleware(handleLoadSession)))
+
+	// 供浏览器使用的 PAC 文件
+	http.HandleFunc("/proxy.pac", handleProxyPAC)
 
 	// 尝试绑定指定端口
-	listener, err := net.Listen("tcp", portStr)
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 	if err != nil {
 		// 端口被占用，尝试随机端口
 		log.Printf("Port %d is in use, trying random port...", port)
-		listener, err = net.Listen("tcp", ":0")
+		listener, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
 		if err != nil {
 			return fmt.Errorf("failed to bind any port: %w", err)
 		}
 	}
 
+	ServerHost = host
 	ServerPort = listener.Addr().(*net.TCPAddr).Port
-	log.Printf("Starting Web Server on port %d", ServerPort)
+
+	// HTTPS 模式下同一端口的明文 HTTP 请求重定向到 HTTPS
+	if EnableTLS {
+		tlsConfig, err := webTLSConfig()
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+		listener = newRedirectListener(listener, tlsConfig)
+	}
+	log.Printf("Starting Web Server on %s://%s", ServerScheme(), listener.Addr().String())
 
 	// 在 goroutine 中启动服务器
 	go func() {
@@ -95,62 +140,26 @@ func StartWebServer(index *embed.FS, port int) error {
 	return nil
 }
 
-func handleDetail(r *http.Request, writer *common.WSConn) {
-	defer writer.Close()
-
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 || pathParts[3] == "" {
-		sendErr(writer, "Request ID is required")
-		return
-	}
-
-	requestID := pathParts[3]
-	log.Printf("Detail streaming client connected for request: %s", requestID)
-	// 安全的ID转换和验证
-	var id int64
-	if _, err := fmt.Sscanf(requestID, "%d", &id); err != nil {
-		sendErr(writer, "Invalid request ID format")
-		return
-	}
-
-	dataProxy := proxy.GetProxy(id)
-	if dataProxy == nil {
-		sendErr(writer, "Detail info has been cleaned!")
-		return
-	}
-
-	// 启动数据流处理
-	dataProxy.OnData(func(dataType common.DataType, data []byte, time time.Time, finished bool) {
-		if err := writer.WriteJSON(common.NewDataChunk(dataType, data, finished)); err != nil {
-			log.Printf("Detail streaming failed for request: %s, reason: %s", requestID, err)
-			return
-		}
-	})
-}
-
-func sendErr(writer *common.WSConn, msg string) {
-	if writeErr := writer.WriteJSON(common.NewDataChunk(common.ERROR, []byte(msg), true)); writeErr != nil {
-		log.Printf("Failed to send error message: %s cause: %v", msg, writeErr)
-	}
-}
-
 // handleProxyConfig 处理代理配置请求
 func handleProxyConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	started, err := proxy.IsStarted()
+	listener, _ := proxy.GetListener(common.DefaultListener)
 	msg := map[string]interface{}{
-		"status": started,
-		"host":   proxy.GetCurrentProxyHost(),
-		"port":   proxy.GetCurrentProxyPort(),
+		"status":      listener.Running,
+		"host":        listener.Host,
+		"port":        listener.Port,
+		"draining":    listener.Draining,
+		"activeConns": listener.ActiveConns,
+		"tunnels":     listener.Tunnels,
 	}
-	if err != nil {
-		msg["msg"] = err.Error()
+	if listener.Error != "" {
+		msg["msg"] = listener.Error
 	}
 	_ = json.NewEncoder(w).Encode(msg)
 }
 
-// handleChangeProxy 处理修改代理配置请求
+// handleChangeProxy 处理修改默认代理监听配置请求
 func handleChangeProxy(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -182,8 +191,15 @@ func handleChangeProxy(w http.ResponseWriter, r *http.Request) {
 		req.Host = "127.0.0.1"
 	}
 
+	cfg := common.ListenerConfig{
+		Name: common.DefaultListener, Mode: common.ListenerModeHTTP, Host: req.Host, Port: req.Port, Enabled: true,
+	}
+	if old, ok := common.GetListenerConfig(common.DefaultListener); ok {
+		cfg.Label = old.Label
+	}
+
 	// 持久化配置
-	if err := common.UpdateProxyConfig(req.Host, req.Port); err != nil {
+	if err := common.SaveListenerConfig(cfg); err != nil {
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
 			"status": false,
 			"msg":    "Failed to save proxy config: " + err.Error(),
@@ -192,7 +208,7 @@ func handleChangeProxy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 重启代理服务器
-	err := proxy.StartProxy(req.Host, req.Port)
+	err := proxy.StartListener(cfg)
 
 	if err != nil {
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -220,6 +236,11 @@ func handleUpstreamProxyConfig(w http.ResponseWriter, r *http.Request) {
 		"protocol": cfg.Protocol,
 		"host":     cfg.Host,
 		"port":     cfg.Port,
+		"pacUrl":   cfg.PacURL,
+	}
+	if cfg.Mode == "pac" {
+		// PAC 脚本加载失败时经过 PAC 的请求会出错，后台持续重试
+		response["pacError"] = proxy.PACError()
 	}
 
 	// 总是尝试获取环境变量中的代理地址，供前端显示
@@ -248,10 +269,11 @@ func handleChangeUpstreamProxy(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var req struct {
-		Mode     string `json:"mode"`     // "none", "env", "custom"
+		Mode     string `json:"mode"`     // "none", "env", "custom", "pac"
 		Protocol string `json:"protocol"` // http, socket5
 		Host     string `json:"host"`
 		Port     int    `json:"port"`
+		PacURL   string `json:"pacUrl"` // PAC 文件路径或 URL
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -339,6 +361,35 @@ func handleChangeUpstreamProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 模式: "pac" - 使用 PAC 脚本
+	if req.Mode == "pac" {
+		if strings.TrimSpace(req.PacURL) == "" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": false,
+				"msg":    "PAC 地址不能为空",
+			})
+			return
+		}
+
+		cfg := common.UpstreamProxyConfig{
+			Mode:   "pac",
+			PacURL: strings.TrimSpace(req.PacURL),
+		}
+
+		if err := proxy.SetUpstreamProxyConfig(cfg); err != nil {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": false,
+				"msg":    "加载 PAC 失败: " + err.Error(),
+			})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": true,
+		})
+		return
+	}
+
 	// 未知模式
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": false,
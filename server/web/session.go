@@ -0,0 +1,126 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+	"proxyMan/server/session"
+	"regexp"
+	"time"
+)
+
+// unsafeFileChars 文件名中不能使用的字符
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// handleSaveSession 保存会话文件，name 为会话名称；ids=1,2,3 保存指定的请求，
+// 否则按 /api/requests 的过滤参数保存，默认保存全部请求
+func handleSaveSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids, err := exportIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "proxyman-" + time.Now().Format("20060102-150405")
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s%s"`, unsafeFileChars.ReplaceAllString(name, "_"), session.Extension))
+
+	writer := session.NewWriter(w, name)
+	for _, id := range ids {
+		dataProxy := proxy.GetProxy(id)
+		if dataProxy == nil {
+			continue
+		}
+		if err := writer.Add(dataProxy.Snapshot()); err != nil {
+			log.Printf("Failed to save session %s: %v", name, err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("Failed to save session %s: %v", name, err)
+	}
+}
+
+// handleLoadSession 打开请求体中的会话文件，请求使用新的 ID 并记录会话名称，name 参数可以覆盖会话名称
+func handleLoadSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// zip 需要随机读取，先写入临时文件
+	f, size, err := saveUpload(http.MaxBytesReader(w, r.Body, maxImportSize))
+	var s *session.Reader
+	if err == nil {
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+		s, err = session.Open(f, size)
+	}
+	if err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		s.Name = name
+	}
+	ids := []int64{}
+	err = s.Each(func(c *common.HttpContents, requestBody, responseBody io.Reader) error {
+		c.Session = s.Name
+		ids = append(ids, proxy.ImportRequest(c, requestBody, responseBody))
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to load session %s after %d requests: %v", s.Name, len(ids), err)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    err.Error(),
+			"name":   s.Name,
+			"ids":    ids,
+		})
+		return
+	}
+
+	log.Printf("Loaded session %s with %d requests", s.Name, len(ids))
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+		"name":   s.Name,
+		"ids":    ids,
+	})
+}
+
+// saveUpload 将上传的内容写入临时文件，成功时由调用方关闭并删除
+func saveUpload(body io.Reader) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "proxyman-upload-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(f, body)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, size, nil
+}
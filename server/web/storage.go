@@ -0,0 +1,67 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+)
+
+// handleStorageConfig 处理持久化存储配置和使用情况获取
+func handleStorageConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cfg := common.GetConfig().Storage
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":     cfg.Enabled,
+		"dir":         cfg.StorageDir(),
+		"maxCount":    cfg.MaxCount,
+		"maxAgeHours": cfg.MaxAgeHours,
+		"maxSizeMB":   cfg.MaxSizeMB,
+		"stats":       proxy.GetStorageStats(),
+	})
+}
+
+// handleChangeStorageConfig 处理修改持久化存储配置请求
+func handleChangeStorageConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Enabled     bool   `json:"enabled"`
+		Dir         string `json:"dir"` // 为空时使用默认目录
+		MaxCount    int    `json:"maxCount"`
+		MaxAgeHours int    `json:"maxAgeHours"`
+		MaxSizeMB   int    `json:"maxSizeMB"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("Failed to decode storage config request: %v", err)
+		return
+	}
+
+	cfg := common.StorageConfig{
+		Enabled:     req.Enabled,
+		Dir:         req.Dir,
+		MaxCount:    req.MaxCount,
+		MaxAgeHours: req.MaxAgeHours,
+		MaxSizeMB:   req.MaxSizeMB,
+	}
+	if err := proxy.SetStorageConfig(cfg); err != nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": false,
+			"msg":    "保存配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": true,
+	})
+}
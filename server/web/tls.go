@@ -0,0 +1,165 @@
+package web
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"proxyMan/server/cert"
+	"sync"
+	"time"
+)
+
+// Web 管理界面的 HTTPS 配置，需要在 StartWebServer 之前设置
+var (
+	EnableTLS   = false // 是否使用 HTTPS，未指定证书时使用 CA 签发的证书
+	TLSCertFile string  // 用户提供的证书文件
+	TLSKeyFile  string  // 用户提供的私钥文件
+)
+
+// ServerScheme 返回 Web 管理界面使用的协议
+func ServerScheme() string {
+	if EnableTLS {
+		return "https"
+	}
+	return "http"
+}
+
+// webTLSConfig 创建 Web 服务器的 TLS 配置
+func webTLSConfig() (*tls.Config, error) {
+	if TLSCertFile != "" || TLSKeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(TLSCertFile, TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls key pair: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{pair}}, nil
+	}
+
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// 通过 IP 访问时没有 SNI，使用客户端连接的本地地址签发
+			serverName := hello.ServerName
+			if serverName == "" && hello.Conn != nil {
+				if host, _, err := net.SplitHostPort(hello.Conn.LocalAddr().String()); err == nil {
+					serverName = host
+				}
+			}
+			if serverName == "" {
+				serverName = "localhost"
+			}
+			return cert.GetCertificate(serverName)
+		},
+	}, nil
+}
+
+// peekedConn 读取时先返回已窥探的数据
+type peekedConn struct {
+	r *bufio.Reader
+	net.Conn
+}
+
+func (c peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// redirectListener 在同一端口上同时接受 HTTPS 和 HTTP 连接：
+// TLS 握手交给 http.Server，明文 HTTP 请求直接重定向到 https://
+type redirectListener struct {
+	net.Listener
+	config *tls.Config
+	conns  chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func newRedirectListener(listener net.Listener, config *tls.Config) *redirectListener {
+	l := &redirectListener{
+		Listener: listener,
+		config:   config,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *redirectListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			l.once.Do(func() { close(l.done) })
+			return
+		}
+		go l.dispatch(conn)
+	}
+}
+
+// dispatch 窥探首字节区分 TLS 和明文 HTTP
+func (l *redirectListener) dispatch(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	firstByte, err := reader.Peek(1)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	// TLS Handshake record type in decimal is 22
+	if firstByte[0] != 0x16 {
+		redirectToHTTPS(reader, conn)
+		return
+	}
+
+	select {
+	case l.conns <- tls.Server(peekedConn{r: reader, Conn: conn}, l.config):
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+func (l *redirectListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *redirectListener) Close() error {
+	err := l.Listener.Close()
+	l.once.Do(func() { close(l.done) })
+	return err
+}
+
+// redirectToHTTPS 将明文 HTTP 请求重定向到相同地址的 HTTPS
+func redirectToHTTPS(reader *bufio.Reader, conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return
+	}
+
+	host := req.Host
+	if host == "" {
+		host = conn.LocalAddr().String()
+	}
+	target := "https://" + host + req.URL.RequestURI()
+	log.Printf("Redirecting web request from %s to %s", conn.RemoteAddr(), target)
+
+	resp := &http.Response{
+		StatusCode: http.StatusPermanentRedirect,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Location": {target}, "Connection": {"close"}},
+		Close:      true,
+	}
+	_ = resp.Write(conn)
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"net/http"
+	"proxyMan/server/common"
+	"proxyMan/server/proxy"
+	"strconv"
+)
+
+// handleTransparentRules 生成透明代理 iptables / nft 规则脚本
+// 参数: format=iptables|nft, uid=用户, cgroup=cgroup v2 路径, tproxy=true|false, port=端口
+func handleTransparentRules(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// 默认使用第一个透明代理监听的端口和模式
+	opts := proxy.TransparentRuleOptions{
+		Format: query.Get("format"),
+		Port:   8889,
+		UID:    query.Get("uid"),
+		Cgroup: query.Get("cgroup"),
+	}
+	if listener, ok := common.GetConfig().FindListener(common.ListenerModeTransparent); ok {
+		opts.Port = listener.Port
+		opts.TProxy = listener.TProxy
+	}
+	if port := query.Get("port"); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			http.Error(w, "Invalid port", http.StatusBadRequest)
+			return
+		}
+		opts.Port = p
+	}
+	if tproxy := query.Get("tproxy"); tproxy != "" {
+		opts.TProxy = tproxy == "true" || tproxy == "1"
+	}
+
+	script, err := proxy.TransparentRules(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-sh")
+	_, _ = w.Write([]byte(script))
+}